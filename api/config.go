@@ -1,40 +1,441 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
 	"github.com/portbound/bootdev-httpserver/internal/database"
+	"github.com/portbound/bootdev-httpserver/internal/mail"
+	"github.com/portbound/bootdev-httpserver/internal/oidc"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
 	FileserverHits atomic.Int32
+	ShuttingDown   atomic.Bool
+	DB             *sql.DB
 	DbQueries      *database.Queries
 	JWT            string
+	Keys           *auth.KeySet
 	PolkaKey       string
+	Platform       string
+	Logger         *slog.Logger
+	Metrics        *Metrics
+	Server         ServerConfig
+	RateLimit      RateLimitConfig
+	Lockout        LockoutConfig
+	AdminKey       string
+	Mailer         mail.Mailer
+	PublicURL      string
+	Verification   VerificationConfig
+	ResetTokenTTL  time.Duration
+	Passwords      auth.PasswordPolicy
+	Hashers        *auth.HasherSet
+	TokenRetention time.Duration
+	Revocations    *TokenRevocations
+	OIDC           map[string]*oidc.Provider
+	EditWindow     time.Duration
+	MaterializeAt  int64
+}
+
+type VerificationConfig struct {
+	Required bool
+	TTL      time.Duration
+}
+
+type ServerConfig struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	MaxHeaderBytes  int
+	MaxBodyBytes    int64
 }
 
 func NewConfig() (*Config, error) {
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+
+	var missing []string
+	for _, name := range []string{"DB_URL", "POLKA_KEY"} {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if os.Getenv("JWT") == "" && os.Getenv("JWT_KEYS") == "" {
+		missing = append(missing, "JWT")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	var errs []error
+	server := ServerConfig{
+		Addr:            envString("ADDR", ":8080"),
+		ReadTimeout:     envDuration("READ_TIMEOUT", 10*time.Second, &errs),
+		WriteTimeout:    envDuration("WRITE_TIMEOUT", 30*time.Second, &errs),
+		IdleTimeout:     envDuration("IDLE_TIMEOUT", 120*time.Second, &errs),
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", 15*time.Second, &errs),
+		DrainDelay:      envDuration("SHUTDOWN_DRAIN_DELAY", 0, &errs),
+		MaxHeaderBytes:  int(envInt("MAX_HEADER_BYTES", 1<<20, &errs)),
+		MaxBodyBytes:    envInt("MAX_BODY_BYTES", 1<<20, &errs),
+	}
+	jwtTTL := envDuration("JWT_TTL", time.Hour, &errs)
+	lockout := loadLockout(&errs)
+	resetTokenTTL := envDuration("PASSWORD_RESET_TTL", 30*time.Minute, &errs)
+	tokenRetention := envDuration("REFRESH_TOKEN_RETENTION", 30*24*time.Hour, &errs)
+	editWindow := envDuration("CHIRP_EDIT_WINDOW", 15*time.Minute, &errs)
+	// following this many accounts switches a user to a materialized
+	// timeline; zero keeps everyone on fan-out on read
+	materializeAt := envInt("TIMELINE_MATERIALIZE_THRESHOLD", 0, &errs)
+	revocationCacheTTL := envDuration("TOKEN_REVOCATION_CACHE_TTL", 30*time.Second, &errs)
+	verification := VerificationConfig{
+		Required: envBool("REQUIRE_EMAIL_VERIFICATION", false, &errs),
+		TTL:      envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour, &errs),
+	}
+	hashers, algorithm := loadHashers(&errs)
+	passwords := loadPasswordPolicy(algorithm, &errs)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	keys, err := loadKeys(os.Getenv("JWT"), os.Getenv("JWT_KEYS"), jwtTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	mailer, err := loadMailer(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	publicURL := strings.TrimSuffix(envString("PUBLIC_URL", "http://localhost:8080"), "/")
+	providers, err := loadOIDCProviders(publicURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Config{
-		JWT:       os.Getenv("JWT"),
-		PolkaKey:  os.Getenv("POLKA_KEY"),
-		DbQueries: database.New(db)}, nil
+	cfg := &Config{
+		JWT:            os.Getenv("JWT"),
+		Keys:           keys,
+		PolkaKey:       os.Getenv("POLKA_KEY"),
+		Platform:       os.Getenv("PLATFORM"),
+		Logger:         logger,
+		Server:         server,
+		Lockout:        lockout,
+		AdminKey:       os.Getenv("ADMIN_KEY"),
+		Mailer:         mailer,
+		PublicURL:      publicURL,
+		Verification:   verification,
+		ResetTokenTTL:  resetTokenTTL,
+		Passwords:      passwords,
+		Hashers:        hashers,
+		TokenRetention: tokenRetention,
+		OIDC:           providers,
+		EditWindow:     editWindow,
+		MaterializeAt:  materializeAt,
+		DB:             db,
+		DbQueries:      database.New(db)}
+	cfg.Revocations = newTokenRevocations(cfg.DbQueries, revocationCacheTTL)
+	cfg.Metrics = newMetrics(cfg)
+	if err := loadRateLimits(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func (cfg *Config) HandlerReadiness(w http.ResponseWriter, r *http.Request) {
-	RespondWithJSON(w, http.StatusOK, "OK")
+func (cfg *Config) Close() error {
+	return cfg.DB.Close()
+}
+
+// CleanupRefreshTokens deletes expired refresh tokens, and revoked ones once
+// they're past the retention period. A rotated token presented after that is
+// simply rejected rather than flagged as reuse.
+func (cfg *Config) CleanupRefreshTokens(ctx context.Context) error {
+	now := time.Now().UTC()
+	n, err := cfg.DbQueries.DeleteStaleRefreshTokens(ctx, database.DeleteStaleRefreshTokensParams{
+		ExpiredBefore: now,
+		RevokedBefore: now.Add(-cfg.TokenRetention),
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		cfg.Logger.InfoContext(ctx, "deleted stale refresh tokens", "count", n)
+	}
+	return nil
+}
+
+// CleanupFailedLogins deletes failed logins too old to count towards a
+// lockout.
+func (cfg *Config) CleanupFailedLogins(ctx context.Context) error {
+	n, err := cfg.DbQueries.DeleteOldFailedLogins(ctx, time.Now().UTC().Add(-cfg.Lockout.Window))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		cfg.Logger.InfoContext(ctx, "deleted old failed logins", "count", n)
+	}
+	return nil
+}
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func envBool(name string, def bool, errs *[]error) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("invalid %s: %w", name, err))
+		return def
+	}
+	return b
+}
+
+func envDuration(name string, def time.Duration, errs *[]error) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("invalid %s: %w", name, err))
+		return def
+	}
+	return d
+}
+
+func envInt(name string, def int64, errs *[]error) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("invalid %s: %w", name, err))
+		return def
+	}
+	return n
+}
+
+// loadHashers returns the password hashers with the configured algorithm
+// preferred. The others stay available to check existing hashes, which get
+// upgraded on the user's next login.
+func loadHashers(errs *[]error) (*auth.HasherSet, string) {
+	bcryptHasher := auth.BcryptHasher{
+		Cost: int(envInt("BCRYPT_COST", int64(bcrypt.DefaultCost), errs)),
+	}
+	if bcryptHasher.Cost < bcrypt.MinCost || bcryptHasher.Cost > bcrypt.MaxCost {
+		*errs = append(*errs, fmt.Errorf("invalid BCRYPT_COST: must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	argon2Hasher := auth.Argon2idHasher{
+		Memory:     uint32(envInt("ARGON2_MEMORY_KIB", 19*1024, errs)),
+		Iterations: uint32(envInt("ARGON2_ITERATIONS", 2, errs)),
+		Threads:    uint8(envInt("ARGON2_THREADS", 1, errs)),
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+	if argon2Hasher.Memory < 8*uint32(argon2Hasher.Threads) || argon2Hasher.Iterations < 1 || argon2Hasher.Threads < 1 {
+		*errs = append(*errs, errors.New("invalid ARGON2_* settings: memory must be at least 8 KiB per thread, iterations and threads at least 1"))
+	}
+
+	switch algorithm := envString("PASSWORD_HASH", "argon2id"); algorithm {
+	case "argon2id":
+		return auth.NewHasherSet(argon2Hasher, bcryptHasher), algorithm
+	case "bcrypt":
+		return auth.NewHasherSet(bcryptHasher, argon2Hasher), algorithm
+	default:
+		*errs = append(*errs, fmt.Errorf("invalid PASSWORD_HASH %q: expected argon2id or bcrypt", algorithm))
+		return nil, algorithm
+	}
+}
+
+func loadPasswordPolicy(algorithm string, errs *[]error) auth.PasswordPolicy {
+	// argon2id has no practical limit, this just bounds the work per request
+	maxLength := 256
+	if algorithm == "bcrypt" {
+		maxLength = auth.BcryptMaxPasswordBytes
+	}
+	policy := auth.PasswordPolicy{
+		MinLength: int(envInt("PASSWORD_MIN_LENGTH", 8, errs)),
+		MaxLength: int(envInt("PASSWORD_MAX_LENGTH", int64(maxLength), errs)),
+	}
+	if algorithm == "bcrypt" && policy.MaxLength > auth.BcryptMaxPasswordBytes {
+		*errs = append(*errs, fmt.Errorf("invalid PASSWORD_MAX_LENGTH: bcrypt only uses the first %d bytes", auth.BcryptMaxPasswordBytes))
+	}
+	if policy.MinLength < 1 || policy.MinLength > policy.MaxLength {
+		*errs = append(*errs, errors.New("invalid PASSWORD_MIN_LENGTH: must be between 1 and PASSWORD_MAX_LENGTH"))
+	}
+
+	if dir := os.Getenv("PASSWORD_BREACH_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			*errs = append(*errs, fmt.Errorf("invalid PASSWORD_BREACH_DIR %q: not a directory", dir))
+		}
+		policy.Breached = &auth.BreachList{Dir: dir}
+	}
+	return policy
+}
+
+func loadMailer(logger *slog.Logger) (mail.Mailer, error) {
+	from := envString("MAIL_FROM", "Chirpy <no-reply@localhost>")
+	switch kind := envString("MAILER", "log"); kind {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, errors.New("missing required environment variables: SMTP_ADDR")
+		}
+		return mail.SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "file":
+		return mail.FileMailer{Dir: envString("MAIL_DIR", "mail"), From: from}, nil
+	case "log":
+		logBody, err := strconv.ParseBool(envString("MAIL_LOG_BODY", "false"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAIL_LOG_BODY: %w", err)
+		}
+		return mail.LogMailer{Logger: logger, LogBody: logBody}, nil
+	default:
+		return nil, fmt.Errorf("invalid MAILER %q: expected smtp, file or log", kind)
+	}
+}
+
+// JWT_KEYS is a comma separated list of PEM files, optionally prefixed with
+// "kid=". The first private key signs new tokens; the rest only verify, which
+// lets a retired key keep validating until its tokens expire. Without
+// JWT_KEYS tokens are signed with HS256 using the JWT secret.
+func loadKeys(secret, files string, ttl time.Duration) (*auth.KeySet, error) {
+	keys := auth.NewKeySet(ttl)
+
+	for _, entry := range strings.Split(files, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			kid, path = "", entry
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := auth.ParsePEMKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := keys.Add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if secret != "" {
+		if err := keys.Add(auth.NewHMACKey("hs256", secret)); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (cfg *Config) MiddlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.FileserverHits.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *Config) HandlerMetrics(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("templates/metrics.html")
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl.Execute(w, map[string]any{"visits": cfg.FileserverHits.Load()})
 }
 
 func (cfg *Config) HandlerReset(w http.ResponseWriter, r *http.Request) {
-	// TODO: reset all tables?
+	if cfg.Platform != "dev" {
+		RespondWithError(w, http.StatusForbidden, "Reset is only allowed in dev environment")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reset: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.DbQueries.WithTx(tx)
+	for _, reset := range []func(context.Context) error{
+		qtx.ResetRefreshTokens,
+		qtx.ResetRevokedJTIs,
+		qtx.ResetOAuthStates,
+		qtx.ResetLinkedIdentities,
+		qtx.ResetEmailVerificationTokens,
+		qtx.ResetPasswordResetTokens,
+		qtx.ResetRecoveryCodes,
+		qtx.ResetUserTOTP,
+		qtx.ResetFailedLoginAttempts,
+		qtx.ResetRateLimitBuckets,
+		qtx.ResetTimelineEntries,
+		qtx.ResetLikes,
+		qtx.ResetRechirps,
+		qtx.ResetFollows,
+		qtx.ResetChirpRevisions,
+		qtx.ResetChirps,
+		qtx.ResetUsers,
+	} {
+		if err := reset(r.Context()); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reset: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reset: %s", err))
+		return
+	}
+
+	// the caches would otherwise keep throttling and rejecting as before
+	if err := cfg.RateLimit.Store.Reset(r.Context()); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reset: %s", err))
+		return
+	}
+	cfg.Revocations.Reset()
+
+	cfg.FileserverHits.Store(0)
+	RespondWithJSON(w, http.StatusOK, "OK")
 }
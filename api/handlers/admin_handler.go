@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, cfg *api.Config) bool {
+	if cfg.AdminKey == "" {
+		api.RespondWithError(w, http.StatusForbidden, "Admin API is disabled")
+		return false
+	}
+
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminKey)) != 1 {
+		api.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+// UnlockUser clears a user's failed logins, along with those from every IP
+// they failed from, since an IP lockout locks them out just the same.
+func UnlockUser(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) {
+	if !authorizeAdmin(w, r, cfg) {
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User not found: %s", err))
+		return
+	}
+
+	params := database.ClearFailedLoginsForUserParams{
+		Email:  user.Email,
+		UserID: user.ID,
+	}
+	if err := cfg.DbQueries.ClearFailedLoginsForUser(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to unlock user: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// RevokeUserTokens signs a user out everywhere, e.g. when their account has
+// been compromised: every refresh token is revoked and every access token
+// already issued stops working.
+func RevokeUserTokens(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) {
+	if !authorizeAdmin(w, r, cfg) {
+		return
+	}
+
+	if err := cfg.Revocations.RevokeAllForUser(r.Context(), userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke tokens: %s", err))
+		return
+	}
+
+	if err := cfg.DbQueries.RevokeAllRefreshTokensForUser(r.Context(), database.RevokeAllRefreshTokensForUserParams{
+		Now:    time.Now().UTC(),
+		UserID: userID,
+	}); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke tokens: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -6,8 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/google/uuid"
@@ -17,7 +18,8 @@ import (
 )
 
 type Chirp struct {
-	Body string `json:"body"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
 }
 
 func (c *Chirp) validate() error {
@@ -35,6 +37,97 @@ func (c *Chirp) clean() {
 	c.Body = s
 }
 
+type chirpResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Body         string     `json:"body"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Edited       bool       `json:"edited"`
+	InReplyTo    *uuid.UUID `json:"in_reply_to,omitempty"`
+	RootID       *uuid.UUID `json:"root_id,omitempty"`
+	ReplyCount   int32      `json:"reply_count"`
+	LikeCount    int32      `json:"like_count"`
+	RechirpCount int32      `json:"rechirp_count"`
+	LikedByMe    *bool      `json:"liked_by_me,omitempty"`
+	RechirpedBy  *uuid.UUID `json:"rechirped_by,omitempty"`
+	RechirpedAt  *time.Time `json:"rechirped_at,omitempty"`
+}
+
+func newChirpResponse(c database.Chirp) chirpResponse {
+	resp := chirpResponse{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt.Time,
+		UpdatedAt:    c.UpdatedAt.Time,
+		Body:         c.Body.String,
+		UserID:       c.UserID,
+		Edited:       c.EditedAt.Valid,
+		ReplyCount:   c.ReplyCount,
+		LikeCount:    c.LikeCount,
+		RechirpCount: c.RechirpCount,
+	}
+	if c.ParentID.Valid {
+		resp.InReplyTo = &c.ParentID.UUID
+	}
+	if c.RootID.Valid {
+		resp.RootID = &c.RootID.UUID
+	}
+	return resp
+}
+
+func chirpRefs(chirps []chirpResponse) []*chirpResponse {
+	refs := make([]*chirpResponse, len(chirps))
+	for i := range chirps {
+		refs[i] = &chirps[i]
+	}
+	return refs
+}
+
+// viewerID identifies the caller on endpoints that don't require a login, so
+// the response can be personalised when they happen to send a valid token.
+func viewerID(r *http.Request, cfg *api.Config) (uuid.UUID, bool) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// markLikedByMe fills in liked_by_me for a signed in caller. Anonymous
+// callers get no liked_by_me at all rather than a misleading false.
+func markLikedByMe(r *http.Request, cfg *api.Config, chirps []*chirpResponse) error {
+	userID, ok := viewerID(r, cfg)
+	if !ok || len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+	liked, err := cfg.DbQueries.ListLikedChirps(r.Context(), database.ListLikedChirpsParams{
+		UserID:   userID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	likedSet := make(map[uuid.UUID]bool, len(liked))
+	for _, id := range liked {
+		likedSet[id] = true
+	}
+	for _, c := range chirps {
+		v := likedSet[c.ID]
+		c.LikedByMe = &v
+	}
+	return nil
+}
+
 func CreateChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	tok, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -42,12 +135,16 @@ func CreateChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 		return
 	}
 
-	validUserID, err := auth.ValidateJWT(tok, cfg.JWT)
+	validUserID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
 	if err != nil {
 		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Unable to validate token: %s", err))
 		return
 	}
 
+	if !requireVerified(w, r, cfg, validUserID) {
+		return
+	}
+
 	chirp := &Chirp{}
 	if err := json.NewDecoder(r.Body).Decode(chirp); err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
@@ -63,55 +160,189 @@ func CreateChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	chirp.clean()
 
 	params := database.CreateChirpParams{
+		Now:    time.Now().UTC(),
 		Body:   sql.NullString{String: chirp.Body, Valid: chirp.Body != ""},
 		UserID: validUserID,
 	}
 
-	createdChirp, err := cfg.DbQueries.CreateChirp(r.Context(), params)
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	if chirp.InReplyTo != nil {
+		// locked so the parent can't be deleted before its reply count is bumped
+		parent, err := qtx.GetChirpForUpdate(r.Context(), *chirp.InReplyTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			api.RespondWithError(w, http.StatusBadRequest, "The chirp being replied to does not exist")
+			return
+		}
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create Chirp: %s", err))
+			return
+		}
+
+		params.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		params.RootID = parent.RootID
+		if !parent.RootID.Valid {
+			params.RootID = params.ParentID
+		}
+
+		if err := qtx.IncrementReplyCount(r.Context(), parent.ID); err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create Chirp: %s", err))
+			return
+		}
+	}
+
+	createdChirp, err := qtx.CreateChirp(r.Context(), params)
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create Chirp: %s", err))
 		return
 	}
 
-	api.RespondWithJSON(w, http.StatusCreated, createdChirp)
+	// only reaches followers with a materialized timeline
+	if err := qtx.FanOutChirp(r.Context(), createdChirp.ID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create Chirp: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create Chirp: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusCreated, newChirpResponse(createdChirp))
+}
+
+type chirpCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
 }
 
+// GetAllChirps lists every chirp, or with author_id that author's feed: their
+// own chirps along with the ones they've rechirped, placed by when they
+// rechirped them.
 func GetAllChirps(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type response struct {
+		Chirps     []chirpResponse `json:"chirps"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
 	author := r.URL.Query().Get("author_id")
 	sortOrder := r.URL.Query().Get("created_at")
-	var (
-		chirps []database.Chirp
-		err    error
-	)
+	cursor := r.URL.Query().Get("cursor")
+
+	pageSize, err := api.ParsePageSize(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// one extra row tells us whether there is a next page
+	params := database.ListChirpsAscParams{PageSize: pageSize + 1}
 
 	if author != "" {
-		author, parseErr := uuid.Parse(author)
-		if parseErr != nil {
-			api.RespondWithError(w, http.StatusBadRequest, parseErr.Error())
+		authorID, err := uuid.Parse(author)
+		if err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		chirps, err = cfg.DbQueries.GetAllChirpsFromUser(r.Context(), author)
-	} else {
-		chirps, err = cfg.DbQueries.GetAllChirps(r.Context())
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
 	}
 
-	if sortOrder == "asc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.Time.Before(chirps[j].CreatedAt.Time)
-		})
+	if cursor != "" {
+		c := chirpCursor{}
+		if err := api.DecodeCursor(cursor, &c); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
 	}
 
-	if sortOrder == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.Time.After(chirps[j].CreatedAt.Time)
-		})
+	if sortOrder != "" && sortOrder != "asc" && sortOrder != "desc" {
+		api.RespondWithError(w, http.StatusBadRequest, "created_at must be asc or desc")
+		return
 	}
 
+	var chirps []chirpResponse
+	var keys []chirpCursor
+	if params.AuthorID.Valid {
+		feedParams := database.ListAuthorFeedAscParams{
+			AuthorID:        params.AuthorID.UUID,
+			CursorCreatedAt: params.CursorCreatedAt,
+			CursorID:        params.CursorID,
+			PageSize:        params.PageSize,
+		}
+		var rows []database.ListAuthorFeedAscRow
+		if sortOrder == "desc" {
+			var desc []database.ListAuthorFeedDescRow
+			desc, err = cfg.DbQueries.ListAuthorFeedDesc(r.Context(), database.ListAuthorFeedDescParams(feedParams))
+			for _, row := range desc {
+				rows = append(rows, database.ListAuthorFeedAscRow(row))
+			}
+		} else {
+			rows, err = cfg.DbQueries.ListAuthorFeedAsc(r.Context(), feedParams)
+		}
+		for _, row := range rows {
+			chirp := newChirpResponse(database.Chirp{
+				ID:           row.ID,
+				CreatedAt:    row.CreatedAt,
+				UpdatedAt:    row.UpdatedAt,
+				Body:         row.Body,
+				UserID:       row.UserID,
+				EditedAt:     row.EditedAt,
+				ParentID:     row.ParentID,
+				RootID:       row.RootID,
+				ReplyCount:   row.ReplyCount,
+				LikeCount:    row.LikeCount,
+				RechirpCount: row.RechirpCount,
+			})
+			if row.IsRechirp {
+				chirp.RechirpedBy = &feedParams.AuthorID
+				chirp.RechirpedAt = &row.ActivityAt.Time
+			}
+			chirps = append(chirps, chirp)
+			keys = append(keys, chirpCursor{CreatedAt: row.ActivityAt.Time, ID: row.ID})
+		}
+	} else {
+		var rows []database.Chirp
+		if sortOrder == "desc" {
+			rows, err = cfg.DbQueries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
+		} else {
+			rows, err = cfg.DbQueries.ListChirpsAsc(r.Context(), params)
+		}
+		for _, row := range rows {
+			chirps = append(chirps, newChirpResponse(row))
+			keys = append(keys, chirpCursor{CreatedAt: row.CreatedAt.Time, ID: row.ID})
+		}
+	}
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch chirps: %s", err))
 		return
 	}
-	api.RespondWithJSON(w, http.StatusOK, chirps)
+
+	resp := response{Chirps: []chirpResponse{}}
+	if len(chirps) > int(pageSize) {
+		chirps = chirps[:pageSize]
+		resp.NextCursor, err = api.EncodeCursor(keys[pageSize-1])
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch chirps: %s", err))
+			return
+		}
+		api.SetNextLink(w, r, resp.NextCursor)
+	}
+	resp.Chirps = append(resp.Chirps, chirps...)
+
+	if err := markLikedByMe(r, cfg, chirpRefs(resp.Chirps)); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch chirps: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, resp)
 }
 
 func GetChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
@@ -120,7 +351,269 @@ func GetChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID u
 		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Chirp not found: %s", err))
 		return
 	}
-	api.RespondWithJSON(w, http.StatusOK, chirp)
+
+	resp := newChirpResponse(chirp)
+	if err := markLikedByMe(r, cfg, []*chirpResponse{&resp}); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// EditChirp replaces a chirp's body, keeping the old one as a revision. Only
+// the author may edit, and only within the configured window after posting.
+// The body is the only editable field, so PUT and PATCH both land here.
+func EditChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if !requireVerified(w, r, cfg, userID) {
+		return
+	}
+
+	chirp := &Chirp{}
+	if err := json.NewDecoder(r.Body).Decode(chirp); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := chirp.validate(); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	chirp.clean()
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	current, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Chirp not found: %s", err))
+		return
+	}
+
+	if current.UserID != userID {
+		api.RespondWithError(w, http.StatusForbidden, "Unauthorized. User does not own chirp")
+		return
+	}
+
+	now := time.Now().UTC()
+	if cfg.EditWindow > 0 && now.Sub(current.CreatedAt.Time) > cfg.EditWindow {
+		api.RespondWithError(w, http.StatusForbidden, fmt.Sprintf("Chirps can only be edited within %s of posting", cfg.EditWindow))
+		return
+	}
+
+	if current.Body.String == chirp.Body {
+		api.RespondWithJSON(w, http.StatusOK, newChirpResponse(current))
+		return
+	}
+
+	params := database.CreateChirpRevisionParams{
+		ChirpID: current.ID,
+		Body:    current.Body,
+		// the time this body was posted, either originally or by an edit
+		WrittenAt:  current.UpdatedAt,
+		ReplacedAt: now,
+	}
+	if err := qtx.CreateChirpRevision(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	updated, err := qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		Body: sql.NullString{String: chirp.Body, Valid: chirp.Body != ""},
+		Now:  now,
+		ID:   current.ID,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, newChirpResponse(updated))
+}
+
+const (
+	defaultThreadDepth = 10
+	maxThreadDepth     = 50
+	maxThreadChirps    = 500
+	maxThreadAncestors = 100
+)
+
+type threadNode struct {
+	chirpResponse
+	Replies []*threadNode `json:"replies"`
+}
+
+// GetChirpThread returns the chirp and its replies as a tree, oldest reply
+// first, along with the chain of chirps it replies to, root first. Replies
+// deeper than depth, or past the overall size cap, are left out; their
+// parents still report a reply_count, so a client can fetch the thread of
+// such a chirp to carry on down. A very long chain keeps only the ancestors
+// nearest the chirp, and a deleted chirp ends it early, though root_id still
+// names the root if that survives.
+func GetChirpThread(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	type response struct {
+		Ancestors []*chirpResponse `json:"ancestors"`
+		Thread    *threadNode      `json:"thread"`
+		Truncated bool             `json:"truncated"`
+	}
+
+	depth := defaultThreadDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		d, err := strconv.Atoi(raw)
+		if err != nil || d < 0 {
+			api.RespondWithError(w, http.StatusBadRequest, "depth must be a non-negative integer")
+			return
+		}
+		if d > maxThreadDepth {
+			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("depth must not exceed %d", maxThreadDepth))
+			return
+		}
+		depth = d
+	}
+
+	// one extra row tells us whether the thread was cut short
+	rows, err := cfg.DbQueries.GetChirpThread(r.Context(), database.GetChirpThreadParams{
+		ID:        chirpID,
+		MaxDepth:  int32(depth),
+		MaxChirps: maxThreadChirps + 1,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch thread: %s", err))
+		return
+	}
+	if len(rows) == 0 {
+		api.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	resp := response{}
+	if len(rows) > maxThreadChirps {
+		rows = rows[:maxThreadChirps]
+		resp.Truncated = true
+	}
+
+	// rows come shallowest first, so a reply's parent is always seen before it
+	nodes := make(map[uuid.UUID]*threadNode, len(rows))
+	refs := make([]*chirpResponse, 0, len(rows))
+	for _, row := range rows {
+		node := &threadNode{
+			chirpResponse: newChirpResponse(database.Chirp{
+				ID:           row.ID,
+				CreatedAt:    row.CreatedAt,
+				UpdatedAt:    row.UpdatedAt,
+				Body:         row.Body,
+				UserID:       row.UserID,
+				EditedAt:     row.EditedAt,
+				ParentID:     row.ParentID,
+				RootID:       row.RootID,
+				ReplyCount:   row.ReplyCount,
+				LikeCount:    row.LikeCount,
+				RechirpCount: row.RechirpCount,
+			}),
+			Replies: []*threadNode{},
+		}
+		nodes[row.ID] = node
+		refs = append(refs, &node.chirpResponse)
+
+		if row.Depth == 0 {
+			resp.Thread = node
+			continue
+		}
+		if parent, ok := nodes[row.ParentID.UUID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	ancestors, err := cfg.DbQueries.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ID:        chirpID,
+		MaxChirps: maxThreadAncestors + 1,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch thread: %s", err))
+		return
+	}
+	if len(ancestors) > maxThreadAncestors {
+		ancestors = ancestors[:maxThreadAncestors]
+		resp.Truncated = true
+	}
+
+	// rows come nearest first
+	resp.Ancestors = make([]*chirpResponse, len(ancestors))
+	for i, row := range ancestors {
+		c := newChirpResponse(database.Chirp{
+			ID:           row.ID,
+			CreatedAt:    row.CreatedAt,
+			UpdatedAt:    row.UpdatedAt,
+			Body:         row.Body,
+			UserID:       row.UserID,
+			EditedAt:     row.EditedAt,
+			ParentID:     row.ParentID,
+			RootID:       row.RootID,
+			ReplyCount:   row.ReplyCount,
+			LikeCount:    row.LikeCount,
+			RechirpCount: row.RechirpCount,
+		})
+		resp.Ancestors[len(ancestors)-1-i] = &c
+		refs = append(refs, &c)
+	}
+
+	if err := markLikedByMe(r, cfg, refs); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch thread: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetChirpRevisions lists the earlier bodies of an edited chirp, oldest
+// first. Like the chirp itself it's public, so no token is needed.
+func GetChirpRevisions(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	type revision struct {
+		Body       string    `json:"body"`
+		WrittenAt  time.Time `json:"written_at"`
+		ReplacedAt time.Time `json:"replaced_at"`
+	}
+
+	if _, err := cfg.DbQueries.GetChirp(r.Context(), chirpID); err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Chirp not found: %s", err))
+		return
+	}
+
+	rows, err := cfg.DbQueries.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch revisions: %s", err))
+		return
+	}
+
+	revisions := make([]revision, 0, len(rows))
+	for _, row := range rows {
+		revisions = append(revisions, revision{
+			Body:       row.Body.String,
+			WrittenAt:  row.WrittenAt.Time,
+			ReplacedAt: row.ReplacedAt,
+		})
+	}
+	api.RespondWithJSON(w, http.StatusOK, revisions)
 }
 
 func DeleteChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
@@ -130,13 +623,22 @@ func DeleteChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpI
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tok, cfg.JWT)
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
 	if err != nil {
 		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpID)
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	// locked so a concurrent delete can't decrement the parent a second time
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
 	if err != nil {
 		api.RespondWithError(w, http.StatusNotFound, err.Error())
 		return
@@ -147,8 +649,22 @@ func DeleteChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpI
 		return
 	}
 
-	if err := cfg.DbQueries.DeleteChirp(r.Context(), chirpID); err != nil {
+	// replies to this chirp are kept, detached from it by the foreign keys
+	n, err := qtx.DeleteChirp(r.Context(), chirpID)
+	if err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+
+	if n > 0 && chirp.ParentID.Valid {
+		if err := qtx.DecrementReplyCount(r.Context(), chirp.ParentID.UUID); err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
 }
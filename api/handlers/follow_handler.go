@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+// a materialized timeline starts out with this many of the latest chirps;
+// anything older is read on the fly, see GetTimeline
+const timelineBackfillLimit = 1000
+
+type followCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func FollowUser(w http.ResponseWriter, r *http.Request, cfg *api.Config, followeeID uuid.UUID) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if userID == followeeID {
+		api.RespondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+		return
+	}
+
+	if _, err := cfg.DbQueries.GetUserByID(r.Context(), followeeID); err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User not found: %s", err))
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	n, err := qtx.Follow(r.Context(), database.FollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if n == 0 {
+		// already following
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return
+	}
+
+	if err := updateMaterializedTimeline(r, cfg, qtx, userID, followeeID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// updateMaterializedTimeline brings userID's materialized timeline up to date
+// with a new follow, switching them over to one if they now follow enough
+// accounts for reading their timeline on the fly to get expensive.
+//
+// A materialized timeline holds every followed chirp from its oldest entry
+// on, which is what lets GetTimeline read on the fly past its end. So the
+// newcomer's chirps are only copied in as far back as that oldest entry.
+func updateMaterializedTimeline(r *http.Request, cfg *api.Config, qtx *database.Queries, userID, followeeID uuid.UUID) error {
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if user.TimelineMaterialized {
+		return qtx.BackfillTimelineFollowee(r.Context(), database.BackfillTimelineFolloweeParams{
+			UserID:     userID,
+			FolloweeID: followeeID,
+		})
+	}
+
+	if cfg.MaterializeAt <= 0 {
+		return nil
+	}
+	following, err := qtx.CountFollowing(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+	if following < cfg.MaterializeAt {
+		return nil
+	}
+	if _, err := qtx.MaterializeTimeline(r.Context(), userID); err != nil {
+		return err
+	}
+	return qtx.BackfillTimeline(r.Context(), database.BackfillTimelineParams{
+		UserID:     userID,
+		MaxEntries: timelineBackfillLimit,
+	})
+}
+
+// dropMaterializedTimeline switches userID back to reading their timeline on
+// the fly once they no longer follow enough accounts to need a copy.
+func dropMaterializedTimeline(r *http.Request, cfg *api.Config, qtx *database.Queries, userID uuid.UUID) error {
+	if cfg.MaterializeAt > 0 {
+		following, err := qtx.CountFollowing(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if following >= cfg.MaterializeAt {
+			return nil
+		}
+	}
+
+	n, err := qtx.DematerializeTimeline(r.Context(), userID)
+	if err != nil || n == 0 {
+		return err
+	}
+	return qtx.ClearTimeline(r.Context(), userID)
+}
+
+func UnfollowUser(w http.ResponseWriter, r *http.Request, cfg *api.Config, followeeID uuid.UUID) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	n, err := qtx.Unfollow(r.Context(), database.UnfollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if n == 0 {
+		api.RespondWithError(w, http.StatusNotFound, "You don't follow this user")
+		return
+	}
+
+	// a no-op unless the timeline is materialized
+	params := database.RemoveFromTimelineParams{
+		UserID:     userID,
+		FolloweeID: followeeID,
+	}
+	if err := qtx.RemoveFromTimeline(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := dropMaterializedTimeline(r, cfg, qtx, userID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+type followResponse struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followListResponse struct {
+	Users      []followResponse `json:"users"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func ListFollowers(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) {
+	params, pageSize, ok := followListParams(w, r, cfg, userID)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.DbQueries.ListFollowers(r.Context(), database.ListFollowersParams{
+		FolloweeID:      userID,
+		CursorCreatedAt: params.CursorCreatedAt,
+		CursorID:        params.CursorID,
+		PageSize:        params.PageSize,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch followers: %s", err))
+		return
+	}
+
+	follows := make([]database.ListFollowingRow, 0, len(rows))
+	for _, row := range rows {
+		follows = append(follows, database.ListFollowingRow(row))
+	}
+	respondWithFollows(w, r, follows, pageSize)
+}
+
+func ListFollowing(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) {
+	params, pageSize, ok := followListParams(w, r, cfg, userID)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.DbQueries.ListFollowing(r.Context(), params)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch following: %s", err))
+		return
+	}
+	respondWithFollows(w, r, rows, pageSize)
+}
+
+func followListParams(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) (database.ListFollowingParams, int32, bool) {
+	if _, err := cfg.DbQueries.GetUserByID(r.Context(), userID); err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User not found: %s", err))
+		return database.ListFollowingParams{}, 0, false
+	}
+
+	pageSize, err := api.ParsePageSize(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return database.ListFollowingParams{}, 0, false
+	}
+
+	// one extra row tells us whether there is a next page
+	params := database.ListFollowingParams{FollowerID: userID, PageSize: pageSize + 1}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		c := followCursor{}
+		if err := api.DecodeCursor(cursor, &c); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return database.ListFollowingParams{}, 0, false
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+	return params, pageSize, true
+}
+
+func respondWithFollows(w http.ResponseWriter, r *http.Request, rows []database.ListFollowingRow, pageSize int32) {
+	resp := followListResponse{Users: []followResponse{}}
+	if len(rows) > int(pageSize) {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		cursor, err := api.EncodeCursor(followCursor{CreatedAt: last.CreatedAt, ID: last.UserID})
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+		resp.NextCursor = cursor
+		api.SetNextLink(w, r, cursor)
+	}
+	for _, row := range rows {
+		resp.Users = append(resp.Users, followResponse{UserID: row.UserID, FollowedAt: row.CreatedAt})
+	}
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetTimeline lists the latest chirps from everyone the caller follows.
+// Most users' timelines are assembled on every read; those following at
+// least cfg.MaterializeAt accounts read a copy kept up to date as chirps are
+// posted, and past the end of that copy the rest is assembled on the fly.
+func GetTimeline(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type response struct {
+		Chirps     []chirpResponse `json:"chirps"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("User not found: %s", err))
+		return
+	}
+
+	pageSize, err := api.ParsePageSize(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// one extra row tells us whether there is a next page
+	params := database.ListTimelineParams{UserID: userID, PageSize: pageSize + 1}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		c := chirpCursor{}
+		if err := api.DecodeCursor(cursor, &c); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	var chirps []database.Chirp
+	if user.TimelineMaterialized {
+		chirps, err = cfg.DbQueries.ListMaterializedTimeline(r.Context(), database.ListMaterializedTimelineParams(params))
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch timeline: %s", err))
+			return
+		}
+		// the copy ran out, so continue from where it ended
+		if len(chirps) < int(params.PageSize) {
+			if len(chirps) > 0 {
+				last := chirps[len(chirps)-1]
+				params.CursorCreatedAt = last.CreatedAt
+				params.CursorID = uuid.NullUUID{UUID: last.ID, Valid: true}
+			}
+			params.PageSize -= int32(len(chirps))
+		} else {
+			params.PageSize = 0
+		}
+	}
+	if params.PageSize > 0 {
+		rest, err := cfg.DbQueries.ListTimeline(r.Context(), params)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch timeline: %s", err))
+			return
+		}
+		chirps = append(chirps, rest...)
+	}
+
+	resp := response{Chirps: []chirpResponse{}}
+	if len(chirps) > int(pageSize) {
+		chirps = chirps[:pageSize]
+		last := chirps[len(chirps)-1]
+		resp.NextCursor, err = api.EncodeCursor(chirpCursor{CreatedAt: last.CreatedAt.Time, ID: last.ID})
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch timeline: %s", err))
+			return
+		}
+		api.SetNextLink(w, r, resp.NextCursor)
+	}
+	for _, c := range chirps {
+		resp.Chirps = append(resp.Chirps, newChirpResponse(c))
+	}
+
+	if err := markLikedByMe(r, cfg, chirpRefs(resp.Chirps)); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch timeline: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
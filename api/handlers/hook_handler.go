@@ -20,31 +20,37 @@ func UpgradeToChirpyRed(w http.ResponseWriter, r *http.Request, cfg *api.Config)
 
 	key, err := auth.GetAPIKey(r.Header)
 	if err != nil {
+		cfg.Metrics.Webhooks.Inc("unknown", "unauthorized")
 		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	if key != cfg.PolkaKey {
+		cfg.Metrics.Webhooks.Inc("unknown", "unauthorized")
 		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintln("Unauthorized"))
 		return
 	}
 
 	h := hook{}
 	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		cfg.Metrics.Webhooks.Inc("unknown", "invalid")
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if h.Event != "user.upgraded" {
 		// quick exit if we're not upgrading th euser
+		cfg.Metrics.Webhooks.Inc("other", "ignored")
 		api.RespondWithJSON(w, http.StatusNoContent, nil)
 		return
 	}
 
 	if err := cfg.DbQueries.SetIsChirpyRed(r.Context(), h.Data.UserID); err != nil {
+		cfg.Metrics.Webhooks.Inc(h.Event, "failed")
 		api.RespondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
+	cfg.Metrics.Webhooks.Inc(h.Event, "processed")
 	api.RespondWithJSON(w, http.StatusOK, nil)
 }
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/portbound/bootdev-httpserver/api"
+)
+
+func GetJWKS(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	api.RespondWithJSON(w, http.StatusOK, cfg.Keys.JWKS())
+}
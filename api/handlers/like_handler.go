@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+func LikeChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	setLike(w, r, cfg, chirpID, true)
+}
+
+func UnlikeChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	setLike(w, r, cfg, chirpID, false)
+}
+
+// setLike likes or unlikes a chirp for the caller and responds with the
+// chirp's updated counts. Repeating either is harmless; the count only moves
+// when the like actually changes.
+func setLike(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID, liked bool) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	chirp, err := qtx.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Chirp not found: %s", err))
+		return
+	}
+
+	var n int64
+	if liked {
+		n, err = qtx.LikeChirp(r.Context(), database.LikeChirpParams{
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now().UTC(),
+		})
+	} else {
+		n, err = qtx.UnlikeChirp(r.Context(), database.UnlikeChirpParams{UserID: userID, ChirpID: chirpID})
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	// a trigger keeps like_count in step, so reread the chirp for it
+	if n > 0 {
+		chirp, err = qtx.GetChirp(r.Context(), chirpID)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	resp := newChirpResponse(chirp)
+	resp.LikedByMe = &liked
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+func RechirpChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	setRechirp(w, r, cfg, chirpID, true)
+}
+
+func UndoRechirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID) {
+	setRechirp(w, r, cfg, chirpID, false)
+}
+
+// setRechirp shares a chirp to, or withdraws it from, the caller's feed. Like
+// posting, sharing needs a verified email when verification is required, and
+// nobody can rechirp their own chirp.
+func setRechirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, chirpID uuid.UUID, rechirped bool) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if rechirped && !requireVerified(w, r, cfg, userID) {
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	chirp, err := qtx.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Chirp not found: %s", err))
+		return
+	}
+
+	if rechirped && chirp.UserID == userID {
+		api.RespondWithError(w, http.StatusBadRequest, "You can't rechirp your own chirp")
+		return
+	}
+
+	var n int64
+	if rechirped {
+		n, err = qtx.Rechirp(r.Context(), database.RechirpParams{
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now().UTC(),
+		})
+	} else {
+		n, err = qtx.UndoRechirp(r.Context(), database.UndoRechirpParams{UserID: userID, ChirpID: chirpID})
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if n > 0 {
+		chirp, err = qtx.GetChirp(r.Context(), chirpID)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	resp := newChirpResponse(chirp)
+	if err := markLikedByMe(r, cfg, []*chirpResponse{&resp}); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
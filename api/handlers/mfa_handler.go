@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+const (
+	mfaPurpose        = "mfa"
+	mfaTokenTTL       = 5 * time.Minute
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+// requireMFA answers the password step of a login for users with TOTP
+// enabled. The mfa_token only proves the password was right; it has to be
+// exchanged at /api/login/mfa along with a code.
+func requireMFA(w http.ResponseWriter, r *http.Request, cfg *api.Config, user database.User) {
+	type response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	tok, err := auth.MakePurposeToken(user.ID, mfaPurpose, uuid.New(), time.Now().UTC().Add(mfaTokenTTL), cfg.Keys)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	cfg.Metrics.Logins.Inc("mfa_required")
+	api.RespondWithJSON(w, http.StatusOK, response{MFARequired: true, MFAToken: tok})
+}
+
+func LoginMFA(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, jti, err := auth.ValidatePurposeToken(req.MFAToken, mfaPurpose, cfg.Keys)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	ip := cfg.RateLimit.ClientIP(r)
+	if !checkLoginWait(w, r, cfg, user.Email, ip) {
+		return
+	}
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), user.ID)
+	if err != nil || !totp.ConfirmedAt.Valid {
+		api.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	var used int64
+	switch {
+	case req.Code != "":
+		step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now(), totp.LastUsedStep)
+		if ok {
+			used, err = cfg.DbQueries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+				UserID:       user.ID,
+				LastUsedStep: step,
+			})
+		}
+	case req.RecoveryCode != "":
+		used, err = useRecoveryCode(r, cfg, user.ID, req.RecoveryCode)
+	default:
+		api.RespondWithError(w, http.StatusBadRequest, "code or recovery_code is required")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if used == 0 {
+		if err := recordFailedLogin(r, cfg, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, ip); err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+		api.RespondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	// the token lives at most mfaTokenTTL, so that bounds its denylist entry
+	fresh, err := cfg.Revocations.Consume(r.Context(), jti, user.ID, time.Now().UTC().Add(mfaTokenTTL))
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if !fresh {
+		api.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	issueLoginTokens(w, r, cfg, user)
+}
+
+// useRecoveryCode spends the user's recovery code matching code, if any.
+// Codes are hashed like passwords, each with its own salt, so every remaining
+// one has to be checked in turn. Codes issued before that were plain SHA-256
+// and still work until they're used or regenerated.
+func useRecoveryCode(r *http.Request, cfg *api.Config, userID uuid.UUID, code string) (int64, error) {
+	rows, err := cfg.DbQueries.ListUnusedRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	code = auth.NormalizeRecoveryCode(code)
+	for _, row := range rows {
+		var match bool
+		if strings.HasPrefix(row.CodeHash, "$") {
+			_, err := cfg.Hashers.Check(row.CodeHash, code)
+			match = err == nil
+		} else {
+			match = subtle.ConstantTimeCompare([]byte(row.CodeHash), []byte(auth.HashToken(code))) == 1
+		}
+		if match {
+			return cfg.DbQueries.UseRecoveryCode(r.Context(), row.ID)
+		}
+	}
+	return 0, nil
+}
+
+// EnrollTOTP issues a new secret for the user to add to their authenticator.
+// It has no effect on login until confirmed, and can be repeated until then.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("User not found: %s", err))
+		return
+	}
+
+	params := database.StartTOTPEnrollmentParams{
+		UserID: user.ID,
+		Secret: auth.GenerateTOTPSecret(),
+	}
+	totp, err := cfg.DbQueries.StartTOTPEnrollment(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, response{
+		Secret:     totp.Secret,
+		OTPAuthURI: auth.TOTPURI(totp.Secret, totpIssuer, user.Email),
+	})
+}
+
+// ConfirmTOTP enables two-factor login once the user proves their
+// authenticator produces the right codes. The recovery codes are only ever
+// shown in this response.
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusNotFound, "No two-factor enrollment in progress")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		api.RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid authentication code")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	n, err := qtx.ConfirmTOTP(r.Context(), database.ConfirmTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if n == 0 {
+		// a concurrent confirm or re-enroll got there first
+		api.RespondWithError(w, http.StatusConflict, "Two-factor enrollment has changed, try again")
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	codes := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	for _, code := range codes {
+		hash, err := cfg.Hashers.Hash(code)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+		params := database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hash,
+		}
+		if err := qtx.CreateRecoveryCode(r.Context(), params); err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
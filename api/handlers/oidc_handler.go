@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+	"github.com/portbound/bootdev-httpserver/internal/oidc"
+)
+
+const (
+	oauthStateTTL    = 10 * time.Minute
+	oauthStateCookie = "oauth_state"
+)
+
+// oauthStateCookiePath scopes the state cookie to the provider's own routes.
+func oauthStateCookiePath(name string) string {
+	return "/api/oauth/" + name + "/"
+}
+
+// OIDCLogin starts a sign in with an external provider by redirecting the
+// user there. The state, nonce and PKCE verifier are kept server side until
+// the provider sends the user back to OIDCCallback, and the state is also
+// set in a cookie so the callback only completes in the browser that started
+// the sign in.
+func OIDCLogin(w http.ResponseWriter, r *http.Request, cfg *api.Config, name string) {
+	provider, ok := cfg.OIDC[name]
+	if !ok {
+		api.RespondWithError(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	now := time.Now().UTC()
+	params := database.CreateOAuthStateParams{
+		State:        oidc.RandomString(),
+		Provider:     name,
+		CodeVerifier: oidc.RandomString(),
+		Nonce:        oidc.RandomString(),
+		Now:          now,
+		ExpiresAt:    now.Add(oauthStateTTL),
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), params.State, params.Nonce, oidc.Challenge(params.CodeVerifier))
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("Identity provider unavailable: %s", err))
+		return
+	}
+
+	if err := cfg.DbQueries.CreateOAuthState(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    params.State,
+		Path:     oauthStateCookiePath(name),
+		MaxAge:   int(oauthStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func OIDCCallback(w http.ResponseWriter, r *http.Request, cfg *api.Config, name string) {
+	provider, ok := cfg.OIDC[name]
+	if !ok {
+		api.RespondWithError(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     oauthStateCookiePath(name),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Sign in was not completed: %s", e))
+		return
+	}
+
+	// without this anyone could send a victim to the callback with their own
+	// code and state and have them signed in to the attacker's account
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid or expired sign in attempt")
+		return
+	}
+
+	state, err := cfg.DbQueries.ConsumeOAuthState(r.Context(), database.ConsumeOAuthStateParams{
+		State:    q.Get("state"),
+		Provider: name,
+		Now:      time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid or expired sign in attempt")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), q.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		cfg.Logger.WarnContext(r.Context(), "oidc exchange failed", "provider", name, "error", err)
+		api.RespondWithError(w, http.StatusUnauthorized, "Could not verify identity with provider")
+		return
+	}
+
+	user, ok := linkedUser(w, r, cfg, name, identity)
+	if !ok {
+		return
+	}
+
+	completeLogin(w, r, cfg, user)
+}
+
+// linkedUser finds the user an external identity belongs to. An identity
+// seen for the first time is linked to the account with the same email, or
+// a new account is created for it. Both rely on the provider having verified
+// the email; linking also needs the local account to have verified it, or
+// whoever registered the address first could take over the other's login.
+func linkedUser(w http.ResponseWriter, r *http.Request, cfg *api.Config, provider string, identity oidc.Identity) (database.User, bool) {
+	link, err := cfg.DbQueries.GetLinkedIdentity(r.Context(), database.GetLinkedIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		user, err := cfg.DbQueries.GetUserByID(r.Context(), link.UserID)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return database.User{}, false
+		}
+		return user, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return database.User{}, false
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		api.RespondWithError(w, http.StatusForbidden, "The identity provider did not supply a verified email address")
+		return database.User{}, false
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return database.User{}, false
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	user, err := qtx.GetUser(r.Context(), identity.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = qtx.CreateVerifiedUser(r.Context(), identity.Email)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return database.User{}, false
+		}
+	case err != nil:
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return database.User{}, false
+	case !user.EmailVerifiedAt.Valid:
+		api.RespondWithError(w, http.StatusConflict, "An account with this email already exists; verify it before signing in with this provider")
+		return database.User{}, false
+	}
+
+	params := database.CreateLinkedIdentityParams{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := qtx.CreateLinkedIdentity(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return database.User{}, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return database.User{}, false
+	}
+	return user, true
+}
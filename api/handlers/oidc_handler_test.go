@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+	"github.com/portbound/bootdev-httpserver/internal/oidc"
+	"github.com/portbound/bootdev-httpserver/internal/oidc/oidctest"
+)
+
+// newOIDCTestConfig builds a config with the mock provider registered as
+// "mock". These tests need a migrated database in TEST_DB_URL.
+func newOIDCTestConfig(t *testing.T) (*api.Config, *oidctest.Provider) {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	mock := oidctest.NewProvider("chirpy", "secret")
+	t.Cleanup(mock.Close)
+
+	t.Setenv("DB_URL", dbURL)
+	t.Setenv("POLKA_KEY", "polka")
+	t.Setenv("JWT", "oidc-test-secret-oidc-test-secret")
+	t.Setenv("PLATFORM", "dev")
+	t.Setenv("OIDC_PROVIDERS", "mock")
+	t.Setenv("OIDC_MOCK_ISSUER", mock.Issuer())
+	t.Setenv("OIDC_MOCK_CLIENT_ID", "chirpy")
+	t.Setenv("OIDC_MOCK_CLIENT_SECRET", "secret")
+
+	cfg, err := api.NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+	t.Cleanup(func() { cfg.DB.Close() })
+	return cfg, mock
+}
+
+// startOIDCLogin runs OIDCLogin and follows its redirect through the mock
+// provider, returning the callback request the browser would then make.
+func startOIDCLogin(t *testing.T, cfg *api.Config) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/api/oauth/mock/login", nil), cfg, "mock")
+	if w.Code != http.StatusFound {
+		t.Fatalf("OIDCLogin: got status %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: bad redirect: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func oidcCallback(cfg *api.Config, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	OIDCCallback(w, req, cfg, "mock")
+	return w
+}
+
+func uniqueEmail() string {
+	return "oidc-" + uuid.NewString() + "@example.com"
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	email := uniqueEmail()
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: email, EmailVerified: true})
+
+	w := oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	resp := loginResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Email != email || !resp.EmailVerified || resp.Token == "" || resp.RefreshToken == "" {
+		t.Errorf("unexpected login response %+v", resp)
+	}
+
+	user, err := cfg.DbQueries.GetUser(context.Background(), email)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.ID != resp.ID || hasLocalPassword(user) {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	// the second sign in finds the linked identity
+	w = oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusOK {
+		t.Fatalf("second sign in: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedUser(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	ctx := context.Background()
+	email := uniqueEmail()
+
+	user, err := cfg.DbQueries.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := cfg.DbQueries.SetEmailVerified(ctx, user.ID); err != nil {
+		t.Fatalf("SetEmailVerified: %v", err)
+	}
+
+	subject := uuid.NewString()
+	mock.SetUser(oidctest.User{Subject: subject, Email: email, EmailVerified: true})
+
+	w := oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	resp := loginResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.ID != user.ID {
+		t.Errorf("signed in as %s, want existing user %s", resp.ID, user.ID)
+	}
+
+	link, err := cfg.DbQueries.GetLinkedIdentity(ctx, database.GetLinkedIdentityParams{Provider: "mock", Subject: subject})
+	if err != nil {
+		t.Fatalf("GetLinkedIdentity: %v", err)
+	}
+	if link.UserID != user.ID {
+		t.Errorf("identity linked to %s, want %s", link.UserID, user.ID)
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedUser(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	email := uniqueEmail()
+
+	if _, err := cfg.DbQueries.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "x"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: email, EmailVerified: true})
+
+	w := oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+}
+
+func TestOIDCCallbackRequiresVerifiedEmail(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	email := uniqueEmail()
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: email, EmailVerified: false})
+
+	w := oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if _, err := cfg.DbQueries.GetUser(context.Background(), email); err == nil {
+		t.Error("a user was created for an unverified email")
+	}
+}
+
+func TestOIDCCallbackRejectsWrongNonce(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: uniqueEmail(), EmailVerified: true})
+	mock.SetTamper(func(c jwt.MapClaims) { c["nonce"] = "not-the-nonce" })
+
+	w := oidcCallback(cfg, startOIDCLogin(t, cfg))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+}
+
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: uniqueEmail(), EmailVerified: true})
+
+	callback := startOIDCLogin(t, cfg)
+	if w := oidcCallback(cfg, callback); w.Code != http.StatusOK {
+		t.Fatalf("first callback: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := oidcCallback(cfg, callback); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback: got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
+
+func TestOIDCCallbackRejectsExpiredState(t *testing.T) {
+	cfg, _ := newOIDCTestConfig(t)
+
+	params := database.CreateOAuthStateParams{
+		State:        oidc.RandomString(),
+		Provider:     "mock",
+		CodeVerifier: oidc.RandomString(),
+		Nonce:        oidc.RandomString(),
+		Now:          time.Now().UTC().Add(-oauthStateTTL),
+		ExpiresAt:    time.Now().UTC().Add(-time.Minute),
+	}
+	if err := cfg.DbQueries.CreateOAuthState(context.Background(), params); err != nil {
+		t.Fatalf("CreateOAuthState: %v", err)
+	}
+
+	callback := &url.URL{Path: "/api/oauth/mock/callback", RawQuery: url.Values{
+		"code":  {"unused"},
+		"state": {params.State},
+	}.Encode()}
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: params.State})
+	if w := oidcCallback(cfg, req); w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
+
+// A callback for a sign in started elsewhere, e.g. one an attacker began and
+// then sent the victim to, must not complete.
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	cfg, mock := newOIDCTestConfig(t)
+	mock.SetUser(oidctest.User{Subject: uuid.NewString(), Email: uniqueEmail(), EmailVerified: true})
+
+	tests := map[string]*http.Cookie{
+		"missing":  nil,
+		"mismatch": {Name: oauthStateCookie, Value: oidc.RandomString()},
+	}
+	for name, cookie := range tests {
+		t.Run(name, func(t *testing.T) {
+			started := startOIDCLogin(t, cfg)
+			req := httptest.NewRequest(http.MethodGet, started.URL.RequestURI(), nil)
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+			if w := oidcCallback(cfg, req); w.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+
+			// the state was not consumed, so the browser that started it can finish
+			if w := oidcCallback(cfg, started); w.Code != http.StatusOK {
+				t.Fatalf("original browser: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+	"github.com/portbound/bootdev-httpserver/internal/mail"
+)
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// the response never says whether the account exists, so the email is
+	// sent after responding rather than making existing accounts slower
+	user, err := cfg.DbQueries.GetUser(r.Context(), req.Email)
+	if err == nil && !hasLocalPassword(user) {
+		cfg.Logger.InfoContext(r.Context(), "password reset requested for account without a password", "user_id", user.ID)
+	} else if err == nil {
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, passwordResetSendTimeout)
+			defer cancel()
+			if err := sendPasswordResetEmail(ctx, cfg, user); err != nil {
+				cfg.Logger.ErrorContext(ctx, "failed to send password reset email", "user_id", user.ID, "error", err)
+			}
+		}()
+	}
+
+	api.RespondWithJSON(w, http.StatusAccepted, nil)
+}
+
+const passwordResetSendTimeout = 30 * time.Second
+
+func sendPasswordResetEmail(ctx context.Context, cfg *api.Config, user database.User) error {
+	tok := auth.MakeRefreshToken()
+	now := time.Now().UTC()
+	params := database.CreatePasswordResetTokenParams{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(tok),
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.ResetTokenTTL),
+	}
+	if err := cfg.DbQueries.CreatePasswordResetToken(ctx, params); err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\nUse this token within %s to choose a new one:\n\n%s\n\nIf this wasn't you, you can ignore this email.\n", cfg.ResetTokenTTL, tok),
+	})
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	now := time.Now().UTC()
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), database.ConsumePasswordResetTokenParams{
+		Now:       now,
+		TokenHash: auth.HashToken(req.Token),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if !hasLocalPassword(user) {
+		api.RespondWithError(w, http.StatusBadRequest, noLocalPasswordMessage)
+		return
+	}
+
+	// rejecting here rolls back, leaving the token usable for another try
+	problems, err := cfg.Passwords.Check(req.Password, user.Email)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if problems != nil {
+		api.RespondWithFieldErrors(w, map[string][]string{"password": problems})
+		return
+	}
+
+	hashedPasswd, err := cfg.Hashers.Hash(req.Password)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to set password")
+		return
+	}
+
+	params := database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPasswd,
+	}
+	if err := qtx.UpdateUserPassword(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	invalidate := database.InvalidatePasswordResetTokensParams{
+		Now:    now,
+		UserID: userID,
+	}
+	if err := qtx.InvalidatePasswordResetTokens(r.Context(), invalidate); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	// whoever knew the old password may still hold a session
+	revoke := database.RevokeAllRefreshTokensForUserParams{
+		Now:    now,
+		UserID: userID,
+	}
+	if err := qtx.RevokeAllRefreshTokensForUser(r.Context(), revoke); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	cfg.Revocations.Forget(userID)
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
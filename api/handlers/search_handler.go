@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+const (
+	maxSearchQueryLength = 256
+	// a match loses half its rank once it's this old, so fresh chirps win
+	// out over slightly better but stale matches
+	searchRecencyHalfLife = 7 * 24 * time.Hour
+)
+
+// searchCursor pins the time ranks were computed at, so that later pages
+// rank chirps exactly as the first one did.
+type searchCursor struct {
+	Rank float64   `json:"r"`
+	ID   uuid.UUID `json:"id"`
+	Now  time.Time `json:"n"`
+}
+
+// tsQuery turns a search box query into a to_tsquery expression. Every term
+// has to match; "quoted words" must appear together in that order, and a
+// trailing * matches any word starting with the term. Everything besides
+// letters and digits is dropped, so user input can never form tsquery syntax
+// of its own.
+func tsQuery(q string) string {
+	var terms []string
+	for i, part := range strings.Split(q, `"`) {
+		// odd parts are the ones between quotes
+		if i%2 == 1 {
+			if phrase := tsPhrase(part, false); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			if phrase := tsPhrase(field, prefix); phrase != "" {
+				terms = append(terms, phrase)
+			}
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+func tsPhrase(s string, prefix bool) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+	if len(words) == 1 {
+		return words[0]
+	}
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
+
+// SearchChirps finds chirps matching q, best first. Rank is Postgres's text
+// rank scaled down by age, see searchRecencyHalfLife.
+func SearchChirps(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type response struct {
+		Chirps     []chirpResponse `json:"chirps"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	q := r.URL.Query().Get("q")
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("q must not exceed %d characters", maxSearchQueryLength))
+		return
+	}
+	query := tsQuery(q)
+	if query == "" {
+		api.RespondWithError(w, http.StatusBadRequest, "q must contain at least one word")
+		return
+	}
+
+	pageSize, err := api.ParsePageSize(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// one extra row tells us whether there is a next page
+	params := database.SearchChirpsParams{
+		Query:           query,
+		Now:             time.Now().UTC(),
+		HalfLifeSeconds: searchRecencyHalfLife.Seconds(),
+		PageSize:        pageSize + 1,
+	}
+
+	if author := r.URL.Query().Get("author_id"); author != "" {
+		authorID, err := uuid.Parse(author)
+		if err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		c := searchCursor{}
+		if err := api.DecodeCursor(cursor, &c); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.Now = c.Now
+		params.CursorRank = sql.NullFloat64{Float64: c.Rank, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	rows, err := cfg.DbQueries.SearchChirps(r.Context(), params)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to search chirps: %s", err))
+		return
+	}
+
+	resp := response{Chirps: []chirpResponse{}}
+	if len(rows) > int(pageSize) {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		resp.NextCursor, err = api.EncodeCursor(searchCursor{Rank: last.Rank, ID: last.ID, Now: params.Now})
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to search chirps: %s", err))
+			return
+		}
+		api.SetNextLink(w, r, resp.NextCursor)
+	}
+	for _, row := range rows {
+		resp.Chirps = append(resp.Chirps, newChirpResponse(database.Chirp{
+			ID:           row.ID,
+			CreatedAt:    row.CreatedAt,
+			UpdatedAt:    row.UpdatedAt,
+			Body:         row.Body,
+			UserID:       row.UserID,
+			EditedAt:     row.EditedAt,
+			ParentID:     row.ParentID,
+			RootID:       row.RootID,
+			ReplyCount:   row.ReplyCount,
+			LikeCount:    row.LikeCount,
+			RechirpCount: row.RechirpCount,
+		}))
+	}
+
+	if err := markLikedByMe(r, cfg, chirpRefs(resp.Chirps)); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to search chirps: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
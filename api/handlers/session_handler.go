@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+const maxUserAgentLength = 512
+
+// sessionUserAgent is recorded to help users recognise their sessions; it's
+// client supplied, so only ever displayed, never trusted.
+func sessionUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ua
+}
+
+// A session is a refresh token family: it starts at login and carries on
+// through every rotation, so its ID stays stable while the token changes.
+func ListSessions(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type session struct {
+		ID         uuid.UUID `json:"id"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		UserAgent  string    `json:"user_agent"`
+		IP         string    `json:"ip"`
+	}
+
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	rows, err := cfg.DbQueries.ListSessions(r.Context(), database.ListSessionsParams{
+		UserID: userID,
+		Now:    time.Now().UTC(),
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	sessions := make([]session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, session{
+			ID:         row.FamilyID,
+			CreatedAt:  row.SessionCreatedAt,
+			LastUsedAt: row.LastUsedAt.Time,
+			ExpiresAt:  row.ExpiresAt.Time,
+			UserAgent:  row.UserAgent,
+			IP:         row.Ip,
+		})
+	}
+	api.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request, cfg *api.Config, sessionID uuid.UUID) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params := database.RevokeRefreshTokenFamilyParams{
+		Now:      time.Now().UTC(),
+		FamilyID: sessionID,
+		UserID:   userID,
+	}
+	n, err := cfg.DbQueries.RevokeRefreshTokenFamily(r.Context(), params)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if n == 0 {
+		api.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if err := cfg.DbQueries.RevokeAllRefreshTokensForUser(r.Context(), database.RevokeAllRefreshTokensForUserParams{
+		Now:    time.Now().UTC(),
+		UserID: userID,
+	}); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := cfg.Revocations.RevokeAllForUser(r.Context(), userID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// Logout revokes the access token it is called with and, if one is given,
+// the session of the accompanying refresh token.
+func Logout(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if _, err := auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations); err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	claims, err := auth.ParseAccessToken(tok, cfg.Keys)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.RefreshToken != "" {
+		refTok, err := cfg.DbQueries.GetRefreshToken(r.Context(), auth.HashToken(req.RefreshToken))
+		if err == nil && refTok.UserID == claims.UserID {
+			params := database.RevokeRefreshTokenFamilyParams{
+				Now:      time.Now().UTC(),
+				FamilyID: refTok.FamilyID,
+				UserID:   claims.UserID,
+			}
+			if _, err := cfg.DbQueries.RevokeRefreshTokenFamily(r.Context(), params); err != nil {
+				api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+				return
+			}
+		}
+	}
+
+	if err := cfg.Revocations.RevokeToken(r.Context(), claims); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/mail"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,9 +17,14 @@ import (
 	"github.com/portbound/bootdev-httpserver/internal/database"
 )
 
+// refresh tokens are rotated on every use, so this only bounds how long a
+// session can sit idle
+const refreshTokenTTL = 60 * 24 * time.Hour
+
 func RefreshAccessToken(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	tok, err := auth.GetBearerToken(r.Header)
@@ -23,56 +33,174 @@ func RefreshAccessToken(w http.ResponseWriter, r *http.Request, cfg *api.Config)
 		return
 	}
 
-	refTok, err := cfg.DbQueries.GetRefreshToken(r.Context(), tok)
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	// the lock makes concurrent refreshes with the same token take turns, so
+	// the checks below see whether the other one already rotated it
+	refTok, err := qtx.GetRefreshTokenForUpdate(r.Context(), auth.HashToken(tok))
 	if err != nil {
+		cfg.Metrics.RefreshTokens.Inc("rejected")
 		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	if refTok.RevokedAt.Valid {
-		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Refresh token has been revoked"))
+		tx.Rollback()
+		rotated, err := cfg.DbQueries.RefreshTokenWasRotated(r.Context(), uuid.NullUUID{UUID: refTok.ID, Valid: true})
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+		if rotated {
+			revokeTokenFamily(w, r, cfg, refTok)
+			return
+		}
+		cfg.Metrics.RefreshTokens.Inc("rejected")
+		api.RespondWithError(w, http.StatusUnauthorized, "Refresh token has been revoked")
+		return
+	}
+
+	// an expired token is just old, not stolen, so the family is left alone
+	now := time.Now().UTC()
+	if !refTok.ExpiresAt.Valid || !now.Before(refTok.ExpiresAt.Time) {
+		cfg.Metrics.RefreshTokens.Inc("rejected")
+		api.RespondWithError(w, http.StatusUnauthorized, "Refresh token has expired")
 		return
 	}
 
-	jwt, err := auth.MakeJWT(refTok.UserID, cfg.JWT)
+	err = qtx.ConsumeRefreshToken(r.Context(), database.ConsumeRefreshTokenParams{
+		Now: now,
+		ID:  refTok.ID,
+	})
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
 		return
 	}
 
+	newTok := auth.MakeRefreshToken()
+	params := database.CreateRefreshTokenParams{
+		TokenHash:        auth.HashToken(newTok),
+		Now:              now,
+		UserID:           refTok.UserID,
+		ExpiresAt:        now.Add(refreshTokenTTL),
+		FamilyID:         refTok.FamilyID,
+		ParentID:         uuid.NullUUID{UUID: refTok.ID, Valid: true},
+		UserAgent:        sessionUserAgent(r),
+		Ip:               cfg.RateLimit.ClientIP(r),
+		SessionCreatedAt: refTok.SessionCreatedAt,
+	}
+	_, err = qtx.CreateRefreshToken(r.Context(), params)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	version, err := qtx.GetUserTokenVersion(r.Context(), refTok.UserID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	jwt, err := auth.MakeJWT(refTok.UserID, version, cfg.Keys)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	cfg.Metrics.RefreshTokens.Inc("rotated")
 	resp := response{
-		Token: jwt,
+		Token:        jwt,
+		RefreshToken: newTok,
 	}
 	api.RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// A rotated token being presented again means it was copied; treat the whole
+// family as compromised.
+func revokeTokenFamily(w http.ResponseWriter, r *http.Request, cfg *api.Config, refTok database.RefreshToken) {
+	cfg.Metrics.RefreshTokens.Inc("reuse_detected")
+	params := database.RevokeRefreshTokenFamilyParams{
+		Now:      time.Now().UTC(),
+		FamilyID: refTok.FamilyID,
+		UserID:   refTok.UserID,
+	}
+	if _, err := cfg.DbQueries.RevokeRefreshTokenFamily(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	api.RespondWithError(w, http.StatusUnauthorized, "Refresh token reuse detected")
+}
+
 func RevokeRefreshToken(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	tok, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if err := cfg.DbQueries.RevokeRefreshToken(r.Context(), tok); err != nil {
+	if err := cfg.DbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		Now:       time.Now().UTC(),
+		TokenHash: auth.HashToken(tok),
+	}); err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	cfg.Metrics.RefreshTokens.Inc("revoked")
 	api.RespondWithJSON(w, http.StatusNoContent, nil)
 }
 
+// userResponse is the public view of a user; everything else in
+// database.User stays server side.
+type userResponse struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+}
+
+func newUserResponse(user database.User) userResponse {
+	return userResponse{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+}
+
+type loginResponse struct {
+	userResponse
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+const noLocalPasswordMessage = "This account signs in through an identity provider and has no password"
+
+// Accounts created through an identity provider have no password of their
+// own, so they can't log in with one, change it or reset it.
+func hasLocalPassword(user database.User) bool {
+	return user.HashedPassword != ""
+}
+
 func Login(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	type request struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type response struct {
-		ID             uuid.UUID `json:"id"`
-		CreatedAt      time.Time `json:"created_at"`
-		UpdatedAt      time.Time `json:"updated_at"`
-		Email          string    `json:"email"`
-		HashedPassword string    `json:"-"`
-		Token          string    `json:"token"`
-		RefreshToken   string    `json:"refresh_token"`
-		IsChirpyRed    bool      `json:"is_chirpy_red"`
-	}
 
 	req := &request{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
@@ -80,18 +208,84 @@ func Login(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 		return
 	}
 
+	ip := cfg.RateLimit.ClientIP(r)
+	if !checkLoginWait(w, r, cfg, req.Email, ip) {
+		return
+	}
+
 	user, err := cfg.DbQueries.GetUser(r.Context(), req.Email)
 	if err != nil {
-		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Could not find user with email: %s", req.Email))
+		cfg.Hashers.DummyCheck(req.Password)
+		loginFailed(w, r, cfg, req.Email, uuid.NullUUID{}, ip)
 		return
 	}
 
-	if err := auth.CheckPasswordHash(user.HashedPassword, req.Password); err != nil {
-		api.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("Invalid password for: %s", req.Email))
+	// answered like a wrong password so as not to reveal how the account signs in
+	if !hasLocalPassword(user) {
+		cfg.Hashers.DummyCheck(req.Password)
+		loginFailed(w, r, cfg, req.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, ip)
 		return
 	}
 
-	jwt, err := auth.MakeJWT(user.ID, cfg.JWT)
+	rehash, err := cfg.Hashers.Check(user.HashedPassword, req.Password)
+	if err != nil {
+		loginFailed(w, r, cfg, req.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, ip)
+		return
+	}
+	if rehash {
+		upgradePasswordHash(r, cfg, user, req.Password)
+	}
+
+	if cfg.Verification.Required && !user.EmailVerifiedAt.Valid {
+		api.RespondWithError(w, http.StatusForbidden, "Email address has not been verified")
+		return
+	}
+
+	completeLogin(w, r, cfg, user)
+}
+
+// completeLogin finishes a login once the user's first factor has been
+// checked, asking for a second one if they've enabled it.
+func completeLogin(w http.ResponseWriter, r *http.Request, cfg *api.Config, user database.User) {
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		requireMFA(w, r, cfg, user)
+		return
+	}
+
+	issueLoginTokens(w, r, cfg, user)
+}
+
+// upgradePasswordHash replaces a hash made with an old algorithm or cost now
+// that the plaintext is at hand. It only applies if the password hasn't
+// changed in the meantime, and failing is harmless, so errors are just logged.
+func upgradePasswordHash(r *http.Request, cfg *api.Config, user database.User, password string) {
+	hash, err := cfg.Hashers.Hash(password)
+	if err == nil {
+		err = cfg.DbQueries.UpgradeUserPasswordHash(r.Context(), database.UpgradeUserPasswordHashParams{
+			NewHash: hash,
+			ID:      user.ID,
+			OldHash: user.HashedPassword,
+		})
+	}
+	if err != nil {
+		cfg.Logger.ErrorContext(r.Context(), "failed to upgrade password hash", "user_id", user.ID, "error", err)
+	}
+}
+
+// issueLoginTokens completes a login once every required factor has been
+// checked.
+func issueLoginTokens(w http.ResponseWriter, r *http.Request, cfg *api.Config, user database.User) {
+	if err := cfg.DbQueries.ClearFailedLogins(r.Context(), user.Email); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	jwt, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.Keys)
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
 		return
@@ -99,48 +293,126 @@ func Login(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 
 	tok := auth.MakeRefreshToken()
 
+	now := time.Now().UTC()
 	params := database.CreateRefreshTokenParams{
-		Token:  tok,
-		UserID: user.ID,
+		TokenHash:        auth.HashToken(tok),
+		Now:              now,
+		UserID:           user.ID,
+		ExpiresAt:        now.Add(refreshTokenTTL),
+		FamilyID:         uuid.New(),
+		UserAgent:        sessionUserAgent(r),
+		Ip:               cfg.RateLimit.ClientIP(r),
+		SessionCreatedAt: now,
 	}
-	refreshToken, err := cfg.DbQueries.CreateRefreshToken(r.Context(), params)
+	_, err = cfg.DbQueries.CreateRefreshToken(r.Context(), params)
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
 	}
 
-	resp := response{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt.Time,
-		UpdatedAt:    user.UpdatedAt.Time,
-		Email:        user.Email,
+	cfg.Metrics.Logins.Inc("success")
+	resp := loginResponse{
+		userResponse: newUserResponse(user),
 		Token:        jwt,
-		RefreshToken: refreshToken.Token,
-		IsChirpyRed:  user.IsChirpyRed,
+		RefreshToken: tok,
 	}
 	api.RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// checkLoginWait responds with 429 and returns false while the email or IP
+// is locked out.
+func checkLoginWait(w http.ResponseWriter, r *http.Request, cfg *api.Config, email, ip string) bool {
+	wait, err := loginWait(r, cfg, email, ip)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return false
+	}
+	if wait > 0 {
+		cfg.Metrics.Logins.Inc("locked")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		api.RespondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return false
+	}
+	return true
+}
+
+func loginWait(r *http.Request, cfg *api.Config, email, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	since := now.Add(-cfg.Lockout.Window)
+
+	byEmail, err := cfg.DbQueries.GetFailedLoginsForEmail(r.Context(), database.GetFailedLoginsForEmailParams{
+		Email:       email,
+		AttemptedAt: since,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	byIP, err := cfg.DbQueries.GetFailedLoginsForIP(r.Context(), database.GetFailedLoginsForIPParams{
+		Ip:          ip,
+		AttemptedAt: since,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return max(
+		cfg.Lockout.Wait(int(byEmail.Failures), cfg.Lockout.MaxFailures, byEmail.LastAttempt, now),
+		cfg.Lockout.Wait(int(byIP.Failures), cfg.Lockout.MaxIPFailures, byIP.LastAttempt, now),
+	), nil
+}
+
+// Unknown emails and wrong passwords get the same response so the endpoint
+// can't be used to discover which accounts exist.
+func loginFailed(w http.ResponseWriter, r *http.Request, cfg *api.Config, email string, userID uuid.NullUUID, ip string) {
+	if err := recordFailedLogin(r, cfg, email, userID, ip); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	api.RespondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+}
+
+func recordFailedLogin(r *http.Request, cfg *api.Config, email string, userID uuid.NullUUID, ip string) error {
+	cfg.Metrics.Logins.Inc("failure")
+
+	params := database.RecordFailedLoginParams{
+		Email:       email,
+		UserID:      userID,
+		Ip:          ip,
+		AttemptedAt: time.Now().UTC(),
+	}
+	return cfg.DbQueries.RecordFailedLogin(r.Context(), params)
+}
+
 func CreateUser(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 	type request struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type response struct {
-		ID             uuid.UUID `json:"id"`
-		CreatedAt      time.Time `json:"created_at"`
-		UpdatedAt      time.Time `json:"updated_at"`
-		Email          string    `json:"email"`
-		HashedPassword string    `json:"-"`
-		IsChirpyRed    bool      `json:"is_chirpy_red"`
-	}
-
 	req := &request{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	hashedPasswd, err := auth.HashPassword(req.Password)
+	fields := map[string][]string{}
+	if !validEmail(req.Email) {
+		fields["email"] = []string{"must be a valid email address"}
+	}
+	problems, err := cfg.Passwords.Check(req.Password, req.Email)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if problems != nil {
+		fields["password"] = problems
+	}
+	if len(fields) > 0 {
+		api.RespondWithFieldErrors(w, fields)
+		return
+	}
+
+	hashedPasswd, err := cfg.Hashers.Hash(req.Password)
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to set password")
 		return
@@ -157,14 +429,11 @@ func CreateUser(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 		return
 	}
 
-	resp := response{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	if err := sendVerificationEmail(r.Context(), cfg, user); err != nil {
+		cfg.Logger.ErrorContext(r.Context(), "failed to send verification email", "user_id", user.ID, "error", err)
 	}
-	api.RespondWithJSON(w, http.StatusCreated, resp)
+
+	api.RespondWithJSON(w, http.StatusCreated, newUserResponse(user))
 }
 
 func UpdateUser(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
@@ -175,7 +444,10 @@ func UpdateUser(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 
 	params := database.UpdateUserParams{}
 	req := request{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
 
 	tok, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -183,26 +455,110 @@ func UpdateUser(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
 		return
 	}
 
-	params.ID, err = auth.ValidateJWT(tok, cfg.JWT)
+	params.ID, err = auth.ValidateJWT(r.Context(), tok, cfg.Keys, cfg.Revocations)
 	if err != nil {
 		api.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if req.Email == "" && req.Password == "" {
+		api.RespondWithError(w, http.StatusBadRequest, "email or password is required")
+		return
+	}
+
+	// fields left empty keep their current value
+	fields := map[string][]string{}
+	if req.Email != "" {
+		if !validEmail(req.Email) {
+			fields["email"] = []string{"must be a valid email address"}
+		}
+		params.Email = req.Email
+	}
+
+	if req.Password != "" {
+		user, err := cfg.DbQueries.GetUserByID(r.Context(), params.ID)
+		if err != nil {
+			api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("User not found: %s", err))
+			return
+		}
+		if !hasLocalPassword(user) {
+			api.RespondWithError(w, http.StatusBadRequest, noLocalPasswordMessage)
+			return
+		}
+
+		email := req.Email
+		if email == "" {
+			email = user.Email
+		}
+		problems, err := cfg.Passwords.Check(req.Password, email)
+		if err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+		if problems != nil {
+			fields["password"] = problems
+		}
+	}
+
+	if len(fields) > 0 {
+		api.RespondWithFieldErrors(w, fields)
+		return
 	}
 
 	if req.Password != "" {
-		params.HashedPassword, err = auth.HashPassword(req.Password)
+		params.HashedPassword, err = cfg.Hashers.Hash(req.Password)
 		if err != nil {
 			api.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
 		}
 	}
 
-	if req.Email != "" {
-		params.Email = req.Email
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
 
-	updatedUser, err := cfg.DbQueries.UpdateUser(r.Context(), params)
+	updatedUser, err := qtx.UpdateUser(r.Context(), params)
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	api.RespondWithJSON(w, http.StatusOK, updatedUser)
+	// a new password bumps the token version and revokes every refresh
+	// token, so whoever knew the old one loses any session they hold
+	if req.Password != "" {
+		revoke := database.RevokeAllRefreshTokensForUserParams{
+			Now:    time.Now().UTC(),
+			UserID: updatedUser.ID,
+		}
+		if err := qtx.RevokeAllRefreshTokensForUser(r.Context(), revoke); err != nil {
+			api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	if req.Password != "" {
+		cfg.Revocations.Forget(updatedUser.ID)
+	}
+
+	// changing the email clears its verification
+	if req.Email != "" && !updatedUser.EmailVerifiedAt.Valid {
+		if err := sendVerificationEmail(r.Context(), cfg, updatedUser); err != nil {
+			cfg.Logger.ErrorContext(r.Context(), "failed to send verification email", "user_id", updatedUser.ID, "error", err)
+		}
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, newUserResponse(updatedUser))
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
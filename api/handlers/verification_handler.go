@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/api"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+	"github.com/portbound/bootdev-httpserver/internal/mail"
+)
+
+const emailVerificationPurpose = "email_verification"
+
+func sendVerificationEmail(ctx context.Context, cfg *api.Config, user database.User) error {
+	now := time.Now().UTC()
+	params := database.CreateEmailVerificationTokenParams{
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.Verification.TTL),
+	}
+	row, err := cfg.DbQueries.CreateEmailVerificationToken(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	tok, err := auth.MakePurposeToken(user.ID, emailVerificationPurpose, row.ID, row.ExpiresAt, cfg.Keys)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", cfg.PublicURL, url.QueryEscape(tok))
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy account",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n", link, cfg.Verification.TTL),
+	})
+}
+
+// requireVerified rejects users who haven't confirmed their email when the
+// deployment requires it.
+func requireVerified(w http.ResponseWriter, r *http.Request, cfg *api.Config, userID uuid.UUID) bool {
+	if !cfg.Verification.Required {
+		return true
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		api.RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("User not found: %s", err))
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		api.RespondWithError(w, http.StatusForbidden, "Email address has not been verified")
+		return false
+	}
+	return true
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type response struct {
+		EmailVerified bool `json:"email_verified"`
+	}
+
+	userID, tokenID, err := auth.ValidatePurposeToken(r.URL.Query().Get("token"), emailVerificationPurpose, cfg.Keys)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbQueries.WithTx(tx)
+
+	params := database.ConsumeEmailVerificationTokenParams{
+		Now:    time.Now().UTC(),
+		ID:     tokenID,
+		UserID: userID,
+	}
+	if _, err := qtx.ConsumeEmailVerificationToken(r.Context(), params); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	if err := qtx.SetEmailVerified(r.Context(), userID); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, response{EmailVerified: true})
+}
+
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request, cfg *api.Config) {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// always accepted so this can't be used to probe for accounts
+	user, err := cfg.DbQueries.GetUser(r.Context(), req.Email)
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		if err := sendVerificationEmail(r.Context(), cfg, user); err != nil {
+			cfg.Logger.ErrorContext(r.Context(), "failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}
+
+	api.RespondWithJSON(w, http.StatusAccepted, nil)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Version   *int64  `json:"version,omitempty"`
+}
+
+func (cfg *Config) HandlerLiveness(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (cfg *Config) HandlerReadyz(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkResult `json:"checks"`
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := response{Status: "ok", Checks: map[string]checkResult{}}
+	resp.Checks["database"] = runCheck(func() (*int64, error) {
+		return nil, cfg.DB.PingContext(ctx)
+	})
+	resp.Checks["migrations"] = runCheck(func() (*int64, error) {
+		var version int64
+		err := cfg.DB.QueryRowContext(ctx,
+			"SELECT version_id FROM goose_db_version WHERE is_applied ORDER BY id DESC LIMIT 1").Scan(&version)
+		return &version, err
+	})
+	if cfg.ShuttingDown.Load() {
+		resp.Checks["shutdown"] = checkResult{Status: "failing", Error: "server is shutting down"}
+	} else {
+		resp.Checks["shutdown"] = checkResult{Status: "ok"}
+	}
+
+	code := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status != "ok" {
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	RespondWithJSON(w, code, resp)
+}
+
+func runCheck(check func() (*int64, error)) checkResult {
+	start := time.Now()
+	version, err := check()
+	res := checkResult{
+		Status:    "ok",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = "failing"
+		res.Error = err.Error()
+		return res
+	}
+	res.Version = version
+	return res
+}
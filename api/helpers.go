@@ -20,5 +20,22 @@ func RespondWithJSON(w http.ResponseWriter, statusCode int, payload any) error {
 }
 
 func RespondWithError(w http.ResponseWriter, code int, msg string) error {
-	return RespondWithJSON(w, code, map[string]string{"error": msg})
+	payload := map[string]string{"error": msg}
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		payload["request_id"] = id
+	}
+	return RespondWithJSON(w, code, payload)
+}
+
+// RespondWithFieldErrors reports request validation failures keyed by the
+// JSON field they apply to.
+func RespondWithFieldErrors(w http.ResponseWriter, fields map[string][]string) error {
+	payload := map[string]any{
+		"error":  "Validation failed",
+		"fields": fields,
+	}
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		payload["request_id"] = id
+	}
+	return RespondWithJSON(w, http.StatusBadRequest, payload)
 }
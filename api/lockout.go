@@ -0,0 +1,45 @@
+package api
+
+import (
+	"time"
+)
+
+// LockoutConfig controls brute-force protection on login. Failures are
+// counted per email and per client IP over Window. Each failure past
+// DelayAfter doubles the wait before the next attempt is accepted, up to
+// MaxDelay; reaching MaxFailures locks the email (or IP) out for Duration
+// from the last failure.
+type LockoutConfig struct {
+	Window        time.Duration
+	Duration      time.Duration
+	DelayAfter    int
+	MaxDelay      time.Duration
+	MaxFailures   int
+	MaxIPFailures int
+}
+
+func loadLockout(errs *[]error) LockoutConfig {
+	return LockoutConfig{
+		Window:        envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute, errs),
+		Duration:      envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute, errs),
+		DelayAfter:    int(envInt("LOGIN_DELAY_AFTER", 2, errs)),
+		MaxDelay:      envDuration("LOGIN_MAX_DELAY", 30*time.Second, errs),
+		MaxFailures:   int(envInt("LOGIN_MAX_FAILURES", 5, errs)),
+		MaxIPFailures: int(envInt("LOGIN_MAX_IP_FAILURES", 50, errs)),
+	}
+}
+
+// Wait returns how long a client with the given failure history must wait
+// before its next login attempt is considered, or zero if it may try now.
+func (l LockoutConfig) Wait(failures, maxFailures int, last, now time.Time) time.Duration {
+	var d time.Duration
+	switch {
+	case failures >= maxFailures:
+		d = l.Duration
+	case failures > l.DelayAfter:
+		d = min(time.Second<<(failures-l.DelayAfter-1), l.MaxDelay)
+	default:
+		return 0
+	}
+	return max(last.Add(d).Sub(now), 0)
+}
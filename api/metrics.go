@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/internal/metrics"
+)
+
+type Metrics struct {
+	Registry        *metrics.Registry
+	Requests        *metrics.CounterVec
+	RequestDuration *metrics.HistogramVec
+	Logins          *metrics.CounterVec
+	RefreshTokens   *metrics.CounterVec
+	Webhooks        *metrics.CounterVec
+}
+
+func newMetrics(cfg *Config) *Metrics {
+	reg := metrics.NewRegistry()
+	m := &Metrics{
+		Registry: reg,
+		Requests: reg.NewCounterVec("chirpy_http_requests_total",
+			"HTTP requests by route pattern, method and status code.", "route", "method", "code"),
+		RequestDuration: reg.NewHistogramVec("chirpy_http_request_duration_seconds",
+			"HTTP request latency by route pattern and method.", metrics.DefaultBuckets, "route", "method"),
+		Logins: reg.NewCounterVec("chirpy_logins_total",
+			"Login attempts by result.", "result"),
+		RefreshTokens: reg.NewCounterVec("chirpy_refresh_tokens_total",
+			"Refresh token events: rotated, revoked, rejected and reuse_detected.", "event"),
+		Webhooks: reg.NewCounterVec("chirpy_webhook_events_total",
+			"Polka webhook deliveries by event and result.", "event", "result"),
+	}
+
+	reg.NewGaugeFunc("chirpy_fileserver_hits", "Requests served by the /app/ fileserver since the last reset.", func() float64 {
+		return float64(cfg.FileserverHits.Load())
+	})
+	registerDBStats(reg, cfg.DB)
+	return m
+}
+
+func registerDBStats(reg *metrics.Registry, db *sql.DB) {
+	stats := []struct {
+		name, help string
+		value      func(sql.DBStats) float64
+	}{
+		{"chirpy_db_max_open_connections", "Maximum number of open connections to the database.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"chirpy_db_open_connections", "Established connections, both in use and idle.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"chirpy_db_in_use_connections", "Connections currently in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"chirpy_db_idle_connections", "Idle connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"chirpy_db_wait_count_total", "Total connections waited for.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"chirpy_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"chirpy_db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"chirpy_db_max_idle_time_closed_total", "Connections closed due to SetConnMaxIdleTime.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"chirpy_db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, s := range stats {
+		value := s.value
+		fn := func() float64 { return value(db.Stats()) }
+		if strings.HasSuffix(s.name, "_total") {
+			reg.NewCounterFunc(s.name, s.help, fn)
+		} else {
+			reg.NewGaugeFunc(s.name, s.help, fn)
+		}
+	}
+}
+
+func (cfg *Config) MiddlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		// unmatched paths would otherwise explode label cardinality
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		cfg.Metrics.Requests.Inc(route, r.Method, strconv.Itoa(rec.status))
+		cfg.Metrics.RequestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
+
+func (cfg *Config) HandlerPrometheus(w http.ResponseWriter, r *http.Request) {
+	cfg.Metrics.Registry.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/internal/oidc"
+)
+
+// loadOIDCProviders reads OIDC_PROVIDERS, a comma separated list of names,
+// and for each name the OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and
+// optional _SCOPES variables. The redirect URL to register with the provider
+// is <PUBLIC_URL>/api/oauth/<name>/callback.
+func loadOIDCProviders(publicURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		var missing []string
+		for _, v := range []string{"ISSUER", "CLIENT_ID", "CLIENT_SECRET"} {
+			if os.Getenv(prefix+v) == "" {
+				missing = append(missing, prefix+v)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+		}
+
+		providers[name] = &oidc.Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s/api/oauth/%s/callback", publicURL, name),
+			Scopes:       strings.Fields(envString(prefix+"SCOPES", "openid email profile")),
+			Client:       client,
+		}
+	}
+	return providers, nil
+}
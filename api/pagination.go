@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+func ParsePageSize(r *http.Request) (int32, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return DefaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > MaxPageSize {
+		return 0, fmt.Errorf("limit must not exceed %d", MaxPageSize)
+	}
+	return int32(limit), nil
+}
+
+// Cursors are opaque to clients; the encoding may change between releases.
+func EncodeCursor(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func DecodeCursor(cursor string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("invalid cursor")
+	}
+	return nil
+}
+
+func SetNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	next := *r.URL
+	q := next.Query()
+	q.Set("cursor", cursor)
+	next.RawQuery = q.Encode()
+	next.Scheme, next.Host = "", ""
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/ratelimit"
+)
+
+type RateLimitConfig struct {
+	Store          ratelimit.Store
+	Limits         map[string]ratelimit.Limit
+	TrustedProxies []netip.Prefix
+}
+
+var defaultRateLimits = map[string]string{
+	"login":  "10/1m",
+	"signup": "5/10m",
+	"chirp":  "30/1m",
+	"email":  "5/10m",
+}
+
+func loadRateLimits(cfg *Config) error {
+	rl := RateLimitConfig{Limits: map[string]ratelimit.Limit{}}
+
+	for name, def := range defaultRateLimits {
+		limit, err := ratelimit.ParseLimit(envString("RATE_LIMIT_"+strings.ToUpper(name), def))
+		if err != nil {
+			return err
+		}
+		rl.Limits[name] = limit
+	}
+
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		rl.TrustedProxies = append(rl.TrustedProxies, prefix.Masked())
+	}
+
+	switch store := envString("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		rl.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		rl.Store = ratelimit.NewPostgresStore(cfg.DB, cfg.DbQueries)
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE %q: expected memory or postgres", store)
+	}
+
+	cfg.RateLimit = rl
+	return nil
+}
+
+// Cleanup drops buckets idle long enough to have refilled completely, which
+// makes them indistinguishable from new ones.
+func (rl RateLimitConfig) Cleanup(ctx context.Context) error {
+	var longest time.Duration
+	for _, l := range rl.Limits {
+		if d := time.Duration(float64(l.Burst) / l.Rate * float64(time.Second)); d > longest {
+			longest = d
+		}
+	}
+	return rl.Store.Cleanup(ctx, time.Now().Add(-longest))
+}
+
+func (rl RateLimitConfig) trusted(addr netip.Addr) bool {
+	for _, p := range rl.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// only honoured when the request came through a trusted proxy; the header is
+// then read right to left, skipping our own proxies, since anything further
+// left is under the client's control.
+func (rl RateLimitConfig) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	remote = remote.Unmap()
+	if !rl.trusted(remote) {
+		return remote.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = addr.Unmap()
+		if !rl.trusted(addr) {
+			return addr.String()
+		}
+	}
+	return remote.String()
+}
+
+// MiddlewareRateLimit throttles next by client IP and, for authenticated
+// requests, by user ID. Store failures are logged and let through so an
+// outage of a shared store doesn't take the API down with it.
+func (cfg *Config) MiddlewareRateLimit(name string, next http.Handler) http.Handler {
+	limit, ok := cfg.RateLimit.Limits[name]
+	if !ok {
+		panic(fmt.Sprintf("no rate limit configured for %q", name))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []string{name + ":ip:" + cfg.RateLimit.ClientIP(r)}
+		if tok, err := auth.GetBearerToken(r.Header); err == nil {
+			if claims, err := auth.ParseAccessToken(tok, cfg.Keys); err == nil {
+				keys = append(keys, name+":user:"+claims.UserID.String())
+			}
+		}
+
+		now := time.Now()
+		var worst *ratelimit.Result
+		for _, key := range keys {
+			res, err := cfg.RateLimit.Store.Take(r.Context(), key, limit, now)
+			if err != nil {
+				cfg.Logger.ErrorContext(r.Context(), "rate limit store failed", "key", key, "error", err)
+				continue
+			}
+			if worst == nil || !res.Allowed || (worst.Allowed && res.Remaining < worst.Remaining) {
+				worst = &res
+			}
+			if !res.Allowed {
+				break
+			}
+		}
+
+		if worst != nil {
+			setRateLimitHeaders(w, *worst)
+			if !worst.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(worst.RetryAfter)))
+				RespondWithError(w, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	rl := RateLimitConfig{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{name: "direct", remote: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "direct ipv6", remote: "[2001:db8::1]:1234", want: "2001:db8::1"},
+		{name: "ipv4 mapped", remote: "[::ffff:203.0.113.7]:1234", want: "203.0.113.7"},
+		{name: "no port", remote: "203.0.113.7", want: "203.0.113.7"},
+		{name: "unparseable remote", remote: "somewhere", want: "somewhere"},
+
+		// anyone can send the header; only our proxies are believed
+		{name: "spoofed from untrusted peer", remote: "203.0.113.7:1234", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "spoofed trusted hop from untrusted peer", remote: "203.0.113.7:1234", xff: []string{"10.0.0.1"}, want: "203.0.113.7"},
+
+		{name: "one trusted proxy", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1, 10.0.0.3, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "client prepends a fake hop", remote: "10.0.0.1:1234", xff: []string{"192.0.2.99, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "client prepends a trusted looking hop", remote: "10.0.0.1:1234", xff: []string{"10.9.9.9, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "split across headers", remote: "10.0.0.1:1234", xff: []string{"192.0.2.99", "198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "ipv6 hops", remote: "[fd00::1]:1234", xff: []string{"2001:db8::5, fd00::2"}, want: "2001:db8::5"},
+		{name: "garbage stops the walk", remote: "10.0.0.1:1234", xff: []string{"198.51.100.1, junk, 10.0.0.2"}, want: "10.0.0.1"},
+		{name: "only trusted hops", remote: "10.0.0.1:1234", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.1"},
+		{name: "trusted proxy without header", remote: "10.0.0.1:1234", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := rl.ClientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/portbound/bootdev-httpserver/internal/auth"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+// TokenRevocations decides whether access tokens have been revoked, either
+// individually through the jti denylist or wholesale by bumping the user's
+// token version. Lookups are cached for TTL, so a revocation made on another
+// instance can take that long to be noticed; revocations made through this
+// type apply locally straight away.
+type TokenRevocations struct {
+	q   *database.Queries
+	ttl time.Duration
+
+	mu       sync.Mutex
+	versions map[uuid.UUID]cachedVersion
+	jtis     map[uuid.UUID]cachedJTI
+}
+
+type cachedVersion struct {
+	version int32
+	expires time.Time
+}
+
+type cachedJTI struct {
+	revoked bool
+	expires time.Time
+}
+
+func newTokenRevocations(q *database.Queries, ttl time.Duration) *TokenRevocations {
+	return &TokenRevocations{
+		q:        q,
+		ttl:      ttl,
+		versions: map[uuid.UUID]cachedVersion{},
+		jtis:     map[uuid.UUID]cachedJTI{},
+	}
+}
+
+func (t *TokenRevocations) Revoked(ctx context.Context, claims auth.AccessClaims) (bool, error) {
+	version, err := t.version(ctx, claims.UserID, claims.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the user has been deleted
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if claims.Version != version {
+		return true, nil
+	}
+
+	// tokens issued before jtis were added can't be denylisted
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return false, nil
+	}
+	return t.jtiRevoked(ctx, jti)
+}
+
+func (t *TokenRevocations) version(ctx context.Context, userID uuid.UUID, want int32) (int32, error) {
+	now := time.Now()
+	t.mu.Lock()
+	c, ok := t.versions[userID]
+	t.mu.Unlock()
+	// a newer token than the cached version means the cache is behind
+	if ok && now.Before(c.expires) && want <= c.version {
+		return c.version, nil
+	}
+
+	version, err := t.q.GetUserTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	t.versions[userID] = cachedVersion{version: version, expires: now.Add(t.ttl)}
+	t.mu.Unlock()
+	return version, nil
+}
+
+func (t *TokenRevocations) jtiRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	now := time.Now()
+	t.mu.Lock()
+	c, ok := t.jtis[jti]
+	t.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.revoked, nil
+	}
+
+	revoked, err := t.q.IsJTIRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	t.mu.Lock()
+	t.jtis[jti] = cachedJTI{revoked: revoked, expires: now.Add(t.ttl)}
+	t.mu.Unlock()
+	return revoked, nil
+}
+
+// RevokeToken denylists a single access token until it expires.
+func (t *TokenRevocations) RevokeToken(ctx context.Context, claims auth.AccessClaims) error {
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return errors.New("token has no jti")
+	}
+
+	params := database.RevokeJTIParams{
+		Jti:       jti,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time.UTC(),
+	}
+	if err := t.q.RevokeJTI(ctx, params); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.jtis[jti] = cachedJTI{revoked: true, expires: claims.ExpiresAt.Time}
+	t.mu.Unlock()
+	return nil
+}
+
+// Consume denylists a single-use token's jti, reporting false if it was
+// already used so that concurrent redemptions can't both succeed.
+func (t *TokenRevocations) Consume(ctx context.Context, jti, userID uuid.UUID, expiresAt time.Time) (bool, error) {
+	n, err := t.q.ConsumeJTI(ctx, database.ConsumeJTIParams{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	t.mu.Lock()
+	t.jtis[jti] = cachedJTI{revoked: true, expires: expiresAt}
+	t.mu.Unlock()
+	return n > 0, nil
+}
+
+// RevokeAllForUser invalidates every access token issued to userID so far.
+func (t *TokenRevocations) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	version, err := t.q.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.versions[userID] = cachedVersion{version: version, expires: time.Now().Add(t.ttl)}
+	t.mu.Unlock()
+	return nil
+}
+
+// Forget drops the cached token version for userID. Call it after changing
+// the version by other means, e.g. as a side effect of a password change.
+func (t *TokenRevocations) Forget(userID uuid.UUID) {
+	t.mu.Lock()
+	delete(t.versions, userID)
+	t.mu.Unlock()
+}
+
+// Reset empties the caches, for use once the tables behind them have been
+// cleared.
+func (t *TokenRevocations) Reset() {
+	t.mu.Lock()
+	clear(t.versions)
+	clear(t.jtis)
+	t.mu.Unlock()
+}
+
+// Cleanup evicts expired cache entries and denylist rows for tokens that
+// have expired on their own.
+func (t *TokenRevocations) Cleanup(ctx context.Context) error {
+	now := time.Now()
+	t.mu.Lock()
+	for id, c := range t.versions {
+		if now.After(c.expires) {
+			delete(t.versions, id)
+		}
+	}
+	for jti, c := range t.jtis {
+		if now.After(c.expires) {
+			delete(t.jtis, jti)
+		}
+	}
+	t.mu.Unlock()
+
+	return t.q.DeleteExpiredRevokedJTIs(ctx, now.UTC())
+}
@@ -10,4 +10,6 @@ require (
 
 require github.com/joho/godotenv v1.5.1
 
-require github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+require github.com/golang-jwt/jwt/v5 v5.2.2
+
+require golang.org/x/sys v0.33.0 // indirect
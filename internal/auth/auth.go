@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,51 +12,120 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(passwd string) (string, error) {
-	bp := []byte(passwd)
-	hashedPasswd, err := bcrypt.GenerateFromPassword(bp, bcrypt.DefaultCost)
+// AccessClaims are the claims carried by access tokens. Version must match
+// the user's current token version; bumping that invalidates every access
+// token issued before.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Version int32     `json:"ver"`
+	UserID  uuid.UUID `json:"-"`
+}
+
+// RevocationChecker reports whether an otherwise valid access token has been
+// revoked since it was issued.
+type RevocationChecker interface {
+	Revoked(ctx context.Context, claims AccessClaims) (bool, error)
+}
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+func MakeJWT(userID uuid.UUID, version int32, keys *KeySet) (string, error) {
+	key, err := keys.Active()
 	if err != nil {
 		return "", err
 	}
-	return string(hashedPasswd), nil
+
+	now := time.Now().UTC()
+	tok := jwt.NewWithClaims(key.Method, AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(keys.TTL)),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+		Version: version,
+	})
+	tok.Header["kid"] = key.ID
+	return tok.SignedString(key.signer)
 }
 
-func CheckPasswordHash(hash string, passwd string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(passwd))
+// ParseAccessToken checks an access token's signature and expiry without
+// consulting revocations. Only use it where acting on a revoked token is
+// harmless, such as attributing log lines.
+func ParseAccessToken(tokenString string, keys *KeySet) (AccessClaims, error) {
+	claims := AccessClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, &claims, keys.lookup); err != nil {
+		return AccessClaims{}, err
+	}
+
+	// purpose tokens carry an audience; they must never work as access tokens
+	if len(claims.Audience) > 0 {
+		return AccessClaims{}, errors.New("not an access token")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	claims.UserID = userID
+	return claims, nil
+}
+
+func ValidateJWT(ctx context.Context, tokenString string, keys *KeySet, revocations RevocationChecker) (uuid.UUID, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	revoked, err := revocations.Revoked(ctx, claims)
 	if err != nil {
-		return err
+		return uuid.UUID{}, err
 	}
-	return nil
+	if revoked {
+		return uuid.UUID{}, ErrTokenRevoked
+	}
+	return claims.UserID, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
-	exp := time.Duration(3600) * time.Second
-	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+// MakePurposeToken signs a single-purpose token (e.g. an email verification
+// link) for userID. id is the token's jti, which callers record so the token
+// can only be used once.
+func MakePurposeToken(userID uuid.UUID, purpose string, id uuid.UUID, expiresAt time.Time, keys *KeySet) (string, error) {
+	key, err := keys.Active()
+	if err != nil {
+		return "", err
+	}
+
+	tok := jwt.NewWithClaims(key.Method, jwt.RegisteredClaims{
 		Issuer:    "chirpy",
+		Audience:  jwt.ClaimStrings{purpose},
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(exp)),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
 		Subject:   userID.String(),
+		ID:        id.String(),
 	})
-	return tok.SignedString([]byte(tokenSecret))
+	tok.Header["kid"] = key.ID
+	return tok.SignedString(key.signer)
 }
 
-func ValidateJWT(tokenString string, tokenSecret string) (uuid.UUID, error) {
-	tok, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.UUID{}, err
+func ValidatePurposeToken(tokenString string, purpose string, keys *KeySet) (userID uuid.UUID, id uuid.UUID, err error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, keys.lookup, jwt.WithAudience(purpose)); err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
 	}
 
-	userID, err := tok.Claims.GetSubject()
+	userID, err = uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.UUID{}, err
+		return uuid.UUID{}, uuid.UUID{}, err
 	}
-
-	return uuid.MustParse(userID), nil
+	id, err = uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	}
+	return userID, id, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -73,6 +144,13 @@ func GetAPIKey(headers http.Header) (string, error) {
 	return "", errors.New("No api key found")
 }
 
+// HashToken digests a high-entropy random token for storage. Unlike
+// passwords these don't need a slow hash to resist guessing.
+func HashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
 func MakeRefreshToken() string {
 	key := make([]byte, 32)
 	rand.Read(key)
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Check(hash, password string) error
+	// Owns reports whether hash is in this hasher's format.
+	Owns(hash string) bool
+	// Outdated reports whether an owned hash was made with parameters other
+	// than the ones the hasher is currently configured with.
+	Outdated(hash string) bool
+}
+
+// HasherSet hashes new passwords with its preferred hasher while still
+// accepting hashes made by the others, so the algorithm or its cost can be
+// changed without invalidating existing passwords.
+type HasherSet struct {
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+	dummy     func() string
+}
+
+func NewHasherSet(preferred PasswordHasher, others ...PasswordHasher) *HasherSet {
+	s := &HasherSet{
+		preferred: preferred,
+		hashers:   append([]PasswordHasher{preferred}, others...),
+	}
+	s.dummy = sync.OnceValue(func() string {
+		hash, _ := preferred.Hash("chirpy-dummy-password")
+		return hash
+	})
+	return s
+}
+
+func (s *HasherSet) Hash(password string) (string, error) {
+	return s.preferred.Hash(password)
+}
+
+// Check verifies password against hash. On success, rehash reports whether
+// hash should be replaced by a fresh Hash of the password.
+func (s *HasherSet) Check(hash, password string) (rehash bool, err error) {
+	for _, h := range s.hashers {
+		if !h.Owns(hash) {
+			continue
+		}
+		if err := h.Check(hash, password); err != nil {
+			return false, err
+		}
+		return h != s.preferred || h.Outdated(hash), nil
+	}
+	return false, errors.New("unrecognised password hash format")
+}
+
+// DummyCheck spends as long as Check so callers can avoid revealing whether
+// an account exists through response timing.
+func (s *HasherSet) DummyCheck(password string) {
+	s.Check(s.dummy(), password)
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Check(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) Owns(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher produces PHC strings such as
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>. Memory is in KiB.
+type Argon2idHasher struct {
+	Memory     uint32
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+type argon2Params struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+var b64 = base64.RawStdEncoding
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Check(hash, password string) error {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) Outdated(hash string) bool {
+	p, err := parseArgon2id(hash)
+	return err != nil ||
+		p.memory != h.Memory ||
+		p.iterations != h.Iterations ||
+		p.threads != h.Threads ||
+		len(p.salt) != int(h.SaltLength) ||
+		len(p.key) != int(h.KeyLength)
+}
+
+func parseArgon2id(hash string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.threads); err != nil {
+		return p, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	var err error
+	if p.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return p, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if p.key, err = b64.DecodeString(parts[5]); err != nil {
+		return p, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	if len(p.key) == 0 {
+		return p, errors.New("invalid argon2id hash")
+	}
+	return p, nil
+}
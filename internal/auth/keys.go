@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	signer any
+	public any
+}
+
+// Signing reports whether the key holds private material and can issue tokens.
+// Public-only keys are kept around to verify tokens from a retired signer.
+func (k *SigningKey) Signing() bool {
+	return k.signer != nil
+}
+
+func NewHMACKey(id string, secret string) *SigningKey {
+	return &SigningKey{
+		ID:     id,
+		Method: jwt.SigningMethodHS256,
+		signer: []byte(secret),
+		public: []byte(secret),
+	}
+}
+
+func ParsePEMKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &SigningKey{ID: id}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Method, k.signer, k.public = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Method, k.public = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.Method, k.signer, k.public = jwt.SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Method, k.public = jwt.SigningMethodEdDSA, key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if k.ID == "" {
+		k.ID, err = thumbprint(k.public)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+type KeySet struct {
+	TTL    time.Duration
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(ttl time.Duration) *KeySet {
+	return &KeySet{
+		TTL:  ttl,
+		keys: map[string]*SigningKey{},
+	}
+}
+
+// Add registers a key for verification. The first signing key added becomes
+// the one new tokens are issued with.
+func (ks *KeySet) Add(k *SigningKey) error {
+	if _, ok := ks.keys[k.ID]; ok {
+		return fmt.Errorf("duplicate key id %q", k.ID)
+	}
+	ks.keys[k.ID] = k
+	if ks.active == nil && k.Signing() {
+		ks.active = k
+	}
+	return nil
+}
+
+func (ks *KeySet) Active() (*SigningKey, error) {
+	if ks.active == nil {
+		return nil, errors.New("no signing key configured")
+	}
+	return ks.active, nil
+}
+
+func (ks *KeySet) lookup(t *jwt.Token) (any, error) {
+	var k *SigningKey
+	if kid, ok := t.Header["kid"].(string); ok {
+		k = ks.keys[kid]
+	} else {
+		// tokens issued before key IDs existed
+		k = ks.keys["hs256"]
+	}
+	if k == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return k.public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key. HMAC secrets are
+// never published.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		jwk, ok := toJWK(k.public)
+		if !ok {
+			continue
+		}
+		jwk.Kid, jwk.Use, jwk.Alg = k.ID, "sig", k.Method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+func toJWK(public any) (JWK, bool) {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: enc(key.N.Bytes()), E: enc(big.NewInt(int64(key.E)).Bytes())}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: enc(key)}, true
+	}
+	return JWK{}, false
+}
+
+// RFC 7638 thumbprint, used as the kid when none is configured.
+func thumbprint(public any) (string, error) {
+	jwk, ok := toJWK(public)
+	if !ok {
+		return "", errors.New("cannot derive key id")
+	}
+
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// BcryptMaxPasswordBytes is the most bcrypt will look at; anything past it is
+// silently ignored, so longer passwords are refused rather than truncated.
+const BcryptMaxPasswordBytes = 72
+
+type PasswordPolicy struct {
+	// MinLength counts characters, MaxLength bytes, since the latter is what
+	// the hash is limited by.
+	MinLength int
+	MaxLength int
+	Breached  *BreachList
+}
+
+// Check returns the reasons password is unacceptable for the account with
+// the given email, or nil if it passes.
+func (p PasswordPolicy) Check(password, email string) ([]string, error) {
+	var problems []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+	if email != "" {
+		local, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, local) {
+			problems = append(problems, "must not be the same as your email address")
+		}
+	}
+	if problems != nil || p.Breached == nil {
+		return problems, nil
+	}
+
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		return nil, err
+	}
+	if breached {
+		problems = append(problems, "appears in a known data breach, choose another")
+	}
+	return problems, nil
+}
+
+// BreachList looks passwords up in an offline copy of a k-anonymity range
+// dataset such as Pwned Passwords: one file per five hex character SHA-1
+// prefix, named <PREFIX>.txt, holding "<SUFFIX>:<COUNT>" lines.
+type BreachList struct {
+	Dir string
+}
+
+func (b *BreachList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed from RFC 6238 appendix B, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The appendix B SHA1 vectors, truncated to our six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("T=%d: %v", v.unix, err)
+		}
+		if got != v.code {
+			t.Errorf("T=%d: got %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now, 0)
+		if !ok || step != TOTPStep(now) {
+			t.Errorf("T=%d: got step %d ok %v, want step %d", v.unix, step, ok, TOTPStep(now))
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	code := "050471"
+
+	t.Run("clock drift", func(t *testing.T) {
+		for _, d := range []time.Duration{-totpPeriod * time.Second, totpPeriod * time.Second} {
+			if _, ok := ValidateTOTP(rfc6238Secret, code, now.Add(d), 0); !ok {
+				t.Errorf("rejected code %v away", d)
+			}
+		}
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now.Add(2*totpPeriod*time.Second), 0); ok {
+			t.Error("accepted code two steps away")
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now, TOTPStep(now)); ok {
+			t.Error("accepted a code for an already used step")
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		if _, ok := ValidateTOTP(rfc6238Secret, "000000", now, 0); ok {
+			t.Error("accepted a wrong code")
+		}
+	})
+
+	t.Run("lowercase secret", func(t *testing.T) {
+		if _, ok := ValidateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code, now, 0); !ok {
+			t.Error("rejected a lowercase secret")
+		}
+	})
+}
@@ -8,29 +8,35 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, root_id)
 VALUES(
 		gen_random_uuid(),
-		NOW(),
-		NOW(),
-		$1,
-		$2
+		$1::timestamp,
+		$1::timestamp,
+		$2,
+		$3,
+		$4,
+		$5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count
 `
 
 type CreateChirpParams struct {
-	Body   sql.NullString
-	UserID uuid.UUID
+	Now      time.Time
+	Body     sql.NullString
+	UserID   uuid.UUID
+	ParentID uuid.NullUUID
+	RootID   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Now, arg.Body, arg.UserID, arg.ParentID, arg.RootID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -38,25 +44,468 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpCount,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
+const createChirpRevision = `-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, written_at, replaced_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4
+)
+`
+
+type CreateChirpRevisionParams struct {
+	ChirpID    uuid.UUID
+	Body       sql.NullString
+	WrittenAt  sql.NullTime
+	ReplacedAt time.Time
+}
+
+func (q *Queries) CreateChirpRevision(ctx context.Context, arg CreateChirpRevisionParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpRevision, arg.ChirpID, arg.Body, arg.WrittenAt, arg.ReplacedAt)
+	return err
+}
+
+const decrementReplyCount = `-- name: DecrementReplyCount :exec
+UPDATE chirps SET reply_count = reply_count - 1 WHERE id = $1 AND reply_count > 0
+`
+
+func (q *Queries) DecrementReplyCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, decrementReplyCount, id)
+	return err
+}
+
+const deleteChirp = `-- name: DeleteChirp :execrows
 DELETE FROM chirps WHERE id = $1
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count FROM chirps WHERE id = $1
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpCount,
+	)
+	return i, err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+	SELECT c.*, 1 AS distance
+	FROM chirps c
+	WHERE c.id = (SELECT parent_id FROM chirps WHERE chirps.id = $1)
+	UNION ALL
+	SELECT c.*, a.distance + 1
+	FROM chirps c
+	JOIN ancestors a ON c.id = a.parent_id
+	WHERE a.distance < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, distance
+FROM ancestors
+ORDER BY distance ASC
+`
+
+type GetChirpAncestorsParams struct {
+	ID        uuid.UUID
+	MaxChirps int32
+}
+
+type GetChirpAncestorsRow struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+	Distance     int32
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ID, arg.MaxChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Distance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count FROM chirps WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpCount,
+	)
+	return i, err
+}
+
+const getChirpThread = `-- name: GetChirpThread :many
+WITH RECURSIVE thread AS (
+	SELECT c.*, 0 AS depth
+	FROM chirps c
+	WHERE c.id = $1
+	UNION ALL
+	SELECT c.*, t.depth + 1
+	FROM chirps c
+	JOIN thread t ON c.parent_id = t.id
+	WHERE t.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, depth
+FROM thread
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT $3
+`
+
+type GetChirpThreadParams struct {
+	ID        uuid.UUID
+	MaxDepth  int32
+	MaxChirps int32
+}
+
+type GetChirpThreadRow struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+	Depth        int32
+}
+
+func (q *Queries) GetChirpThread(ctx context.Context, arg GetChirpThreadParams) ([]GetChirpThreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpThread, arg.ID, arg.MaxDepth, arg.MaxChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpThreadRow
+	for rows.Next() {
+		var i GetChirpThreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementReplyCount = `-- name: IncrementReplyCount :exec
+UPDATE chirps SET reply_count = reply_count + 1 WHERE id = $1
+`
+
+func (q *Queries) IncrementReplyCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, incrementReplyCount, id)
 	return err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at
+const listAuthorFeedAsc = `-- name: ListAuthorFeedAsc :many
+SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.parent_id, c.root_id, c.reply_count, c.like_count, c.rechirp_count, feed.activity_at, feed.is_rechirp
+FROM (
+	SELECT id AS chirp_id, created_at AS activity_at, false AS is_rechirp
+	FROM chirps WHERE user_id = $1
+	UNION ALL
+	SELECT chirp_id, created_at, true
+	FROM rechirps WHERE user_id = $1
+) feed
+JOIN chirps c ON c.id = feed.chirp_id
+WHERE $2::timestamp IS NULL
+OR (feed.activity_at, feed.chirp_id) > ($2::timestamp, $3::uuid)
+ORDER BY feed.activity_at ASC, feed.chirp_id ASC
+LIMIT $4
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+type ListAuthorFeedAscParams struct {
+	AuthorID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+type ListAuthorFeedAscRow struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+	ActivityAt   sql.NullTime
+	IsRechirp    bool
+}
+
+func (q *Queries) ListAuthorFeedAsc(ctx context.Context, arg ListAuthorFeedAscParams) ([]ListAuthorFeedAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAuthorFeedAsc, arg.AuthorID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAuthorFeedAscRow
+	for rows.Next() {
+		var i ListAuthorFeedAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.ActivityAt,
+			&i.IsRechirp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuthorFeedDesc = `-- name: ListAuthorFeedDesc :many
+SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.parent_id, c.root_id, c.reply_count, c.like_count, c.rechirp_count, feed.activity_at, feed.is_rechirp
+FROM (
+	SELECT id AS chirp_id, created_at AS activity_at, false AS is_rechirp
+	FROM chirps WHERE user_id = $1
+	UNION ALL
+	SELECT chirp_id, created_at, true
+	FROM rechirps WHERE user_id = $1
+) feed
+JOIN chirps c ON c.id = feed.chirp_id
+WHERE $2::timestamp IS NULL
+OR (feed.activity_at, feed.chirp_id) < ($2::timestamp, $3::uuid)
+ORDER BY feed.activity_at DESC, feed.chirp_id DESC
+LIMIT $4
+`
+
+type ListAuthorFeedDescParams struct {
+	AuthorID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+type ListAuthorFeedDescRow struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+	ActivityAt   sql.NullTime
+	IsRechirp    bool
+}
+
+func (q *Queries) ListAuthorFeedDesc(ctx context.Context, arg ListAuthorFeedDescParams) ([]ListAuthorFeedDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAuthorFeedDesc, arg.AuthorID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAuthorFeedDescRow
+	for rows.Next() {
+		var i ListAuthorFeedDescRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.ActivityAt,
+			&i.IsRechirp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, chirp_id, body, written_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at ASC, id ASC
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.WrittenAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+AND (
+	$2::timestamp IS NULL
+	OR (created_at, id) > ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc, arg.AuthorID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +519,12 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
 		); err != nil {
 			return nil, err
 		}
@@ -84,14 +539,26 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getAllChirpsFromUser = `-- name: GetAllChirpsFromUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps 
-WHERE user_id = $1
-ORDER BY created_at
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+AND (
+	$2::timestamp IS NULL
+	OR (created_at, id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetAllChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirpsFromUser, userID)
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc, arg.AuthorID, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -105,6 +572,12 @@ func (q *Queries) GetAllChirpsFromUser(ctx context.Context, userID uuid.UUID) ([
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
 		); err != nil {
 			return nil, err
 		}
@@ -119,12 +592,118 @@ func (q *Queries) GetAllChirpsFromUser(ctx context.Context, userID uuid.UUID) ([
 	return items, nil
 }
 
-const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+const resetChirpRevisions = `-- name: ResetChirpRevisions :exec
+TRUNCATE chirp_revisions CASCADE
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+func (q *Queries) ResetChirpRevisions(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetChirpRevisions)
+	return err
+}
+
+const resetChirps = `-- name: ResetChirps :exec
+TRUNCATE chirps CASCADE
+`
+
+func (q *Queries) ResetChirps(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetChirps)
+	return err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, rank
+FROM (
+	SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.parent_id, c.root_id, c.reply_count, c.like_count, c.rechirp_count,
+		(ts_rank(to_tsvector('english', coalesce(c.body, '')), to_tsquery('english', $1))
+		/ (1 + EXTRACT(EPOCH FROM $2::timestamp - c.created_at) / $3::float8))::float8
+		AS rank
+	FROM chirps c
+	WHERE to_tsvector('english', coalesce(c.body, '')) @@ to_tsquery('english', $1)
+	AND ($4::uuid IS NULL OR c.user_id = $4::uuid)
+	AND c.created_at <= $2::timestamp
+) ranked
+WHERE $5::float8 IS NULL
+OR (rank, id) < ($5::float8, $6::uuid)
+ORDER BY rank DESC, id DESC
+LIMIT $7
+`
+
+type SearchChirpsParams struct {
+	Query           string
+	Now             time.Time
+	HalfLifeSeconds float64
+	AuthorID        uuid.NullUUID
+	CursorRank      sql.NullFloat64
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+type SearchChirpsRow struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+	Rank         float64
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps, arg.Query, arg.Now, arg.HalfLifeSeconds, arg.AuthorID, arg.CursorRank, arg.CursorID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpCount,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = $2::timestamp, edited_at = $2::timestamp
+WHERE id = $3
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count
+`
+
+type UpdateChirpBodyParams struct {
+	Body sql.NullString
+	Now  time.Time
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.Now, arg.ID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -132,6 +711,12 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpCount,
 	)
 	return i, err
 }
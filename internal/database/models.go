@@ -6,32 +6,152 @@ package database
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.UUID
+	EditedAt     sql.NullTime
+	ParentID     uuid.NullUUID
+	RootID       uuid.NullUUID
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpCount int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       sql.NullString
+	WrittenAt  sql.NullTime
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type FailedLoginAttempt struct {
+	ID          uuid.UUID
+	Email       string
+	UserID      uuid.NullUUID
+	Ip          string
+	AttemptedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LinkedIdentity struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type MfaRecoveryCode struct {
 	ID        uuid.UUID
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
-	Body      sql.NullString
 	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type OauthState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type Rechirp struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
 }
 
 type RefreshToken struct {
-	Token     string
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+	CreatedAt        sql.NullTime
+	UpdatedAt        sql.NullTime
+	UserID           uuid.UUID
+	ExpiresAt        sql.NullTime
+	RevokedAt        sql.NullTime
+	FamilyID         uuid.UUID
+	UserAgent        string
+	Ip               string
+	SessionCreatedAt time.Time
+	ID               uuid.UUID
+	TokenHash        string
+	ParentID         uuid.NullUUID
+}
+
+type RevokedJti struct {
+	Jti       uuid.UUID
 	UserID    uuid.UUID
-	ExpiresAt sql.NullTime
-	RevokedAt sql.NullTime
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type TimelineEntry struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      sql.NullTime
-	UpdatedAt      sql.NullTime
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                   uuid.UUID
+	CreatedAt            sql.NullTime
+	UpdatedAt            sql.NullTime
+	Email                string
+	HashedPassword       string
+	IsChirpyRed          bool
+	EmailVerifiedAt      sql.NullTime
+	TokenVersion         int32
+	TimelineMaterialized bool
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+	CreatedAt    time.Time
 }
@@ -7,67 +7,265 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const consumeRefreshToken = `-- name: ConsumeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = $1::timestamp, updated_at = $1::timestamp
+WHERE id = $2
+`
+
+type ConsumeRefreshTokenParams struct {
+	Now time.Time
+	ID  uuid.UUID
+}
+
+func (q *Queries) ConsumeRefreshToken(ctx context.Context, arg ConsumeRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, consumeRefreshToken, arg.Now, arg.ID)
+	return err
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_id, user_agent, ip, session_created_at)
 VALUES(
+	gen_random_uuid(),
 	$1,
-	NOW(),
-	NOW(),
-	$2,
-	NOW() + interval '60 days',
-	NULL
+	$2::timestamp,
+	$2::timestamp,
+	$3,
+	$4::timestamp,
+	NULL,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, session_created_at, id, token_hash, parent_id
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenHash        string
+	Now              time.Time
+	UserID           uuid.UUID
+	ExpiresAt        time.Time
+	FamilyID         uuid.UUID
+	ParentID         uuid.NullUUID
+	UserAgent        string
+	Ip               string
+	SessionCreatedAt time.Time
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.TokenHash, arg.Now, arg.UserID, arg.ExpiresAt, arg.FamilyID, arg.ParentID, arg.UserAgent, arg.Ip, arg.SessionCreatedAt)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.SessionCreatedAt,
+		&i.ID,
+		&i.TokenHash,
+		&i.ParentID,
 	)
 	return i, err
 }
 
+const deleteStaleRefreshTokens = `-- name: DeleteStaleRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < $1::timestamp
+	OR revoked_at < $2::timestamp
+`
+
+type DeleteStaleRefreshTokensParams struct {
+	ExpiredBefore time.Time
+	RevokedBefore time.Time
+}
+
+func (q *Queries) DeleteStaleRefreshTokens(ctx context.Context, arg DeleteStaleRefreshTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleRefreshTokens, arg.ExpiredBefore, arg.RevokedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1 LIMIT 1
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, session_created_at, id, token_hash, parent_id FROM refresh_tokens WHERE token_hash = $1 LIMIT 1
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.SessionCreatedAt,
+		&i.ID,
+		&i.TokenHash,
+		&i.ParentID,
 	)
 	return i, err
 }
 
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, session_created_at, id, token_hash, parent_id FROM refresh_tokens WHERE token_hash = $1 LIMIT 1 FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.SessionCreatedAt,
+		&i.ID,
+		&i.TokenHash,
+		&i.ParentID,
+	)
+	return i, err
+}
+
+const listSessions = `-- name: ListSessions :many
+SELECT family_id, session_created_at, created_at AS last_used_at, expires_at, user_agent, ip
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2::timestamp
+ORDER BY created_at DESC
+`
+
+type ListSessionsParams struct {
+	UserID uuid.UUID
+	Now    time.Time
+}
+
+type ListSessionsRow struct {
+	FamilyID         uuid.UUID
+	SessionCreatedAt time.Time
+	LastUsedAt       sql.NullTime
+	ExpiresAt        sql.NullTime
+	UserAgent        string
+	Ip               string
+}
+
+func (q *Queries) ListSessions(ctx context.Context, arg ListSessionsParams) ([]ListSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, arg.UserID, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionsRow
+	for rows.Next() {
+		var i ListSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.SessionCreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.UserAgent,
+			&i.Ip,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const refreshTokenWasRotated = `-- name: RefreshTokenWasRotated :one
+SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE parent_id = $1)
+`
+
+func (q *Queries) RefreshTokenWasRotated(ctx context.Context, parentID uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, refreshTokenWasRotated, parentID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const resetRefreshTokens = `-- name: ResetRefreshTokens :exec
+TRUNCATE refresh_tokens CASCADE
+`
+
+func (q *Queries) ResetRefreshTokens(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetRefreshTokens)
+	return err
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = $1::timestamp, updated_at = $1::timestamp
+WHERE user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeAllRefreshTokensForUserParams struct {
+	Now    time.Time
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, arg RevokeAllRefreshTokensForUserParams) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, arg.Now, arg.UserID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
-UPDATE refresh_tokens 
-SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+UPDATE refresh_tokens
+SET revoked_at = $1::timestamp, updated_at = $1::timestamp
+WHERE token_hash = $2
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+type RevokeRefreshTokenParams struct {
+	Now       time.Time
+	TokenHash string
+}
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, arg RevokeRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, arg.Now, arg.TokenHash)
 	return err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = $1::timestamp, updated_at = $1::timestamp
+WHERE family_id = $2 AND user_id = $3 AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokenFamilyParams struct {
+	Now      time.Time
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, arg RevokeRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, arg.Now, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -11,6 +11,20 @@ import (
 	"github.com/google/uuid"
 )
 
+const bumpTokenVersion = `-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, bumpTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password, is_chirpy_red)
 VALUES(
@@ -21,7 +35,7 @@ VALUES(
 		$2,
 		false
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, token_version, timeline_materialized
 `
 
 type CreateUserParams struct {
@@ -39,12 +53,46 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.TimelineMaterialized,
+	)
+	return i, err
+}
+
+const createVerifiedUser = `-- name: CreateVerifiedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	'',
+	false,
+	NOW()
+)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, token_version, timeline_materialized
+`
+
+func (q *Queries) CreateVerifiedUser(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, createVerifiedUser, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.TimelineMaterialized,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, token_version, timeline_materialized FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
@@ -57,10 +105,65 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.TimelineMaterialized,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, token_version, timeline_materialized FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.TimelineMaterialized,
 	)
 	return i, err
 }
 
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+SELECT token_version FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const resetUsers = `-- name: ResetUsers :exec
+TRUNCATE users CASCADE
+`
+
+func (q *Queries) ResetUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, resetUsers)
+	return err
+}
+
+const setEmailVerified = `-- name: SetEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+`
+
+func (q *Queries) SetEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, setEmailVerified, id)
+	return err
+}
+
 const setIsChirpyRed = `-- name: SetIsChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = true
@@ -74,9 +177,13 @@ func (q *Queries) SetIsChirpyRed(ctx context.Context, id uuid.UUID) error {
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users 
-SET updated_at = NOW(), email = $2, hashed_password = $3 
+SET updated_at = NOW(),
+	email = COALESCE(NULLIF($2, ''), email),
+	hashed_password = COALESCE(NULLIF($3, ''), hashed_password),
+	email_verified_at = CASE WHEN email = COALESCE(NULLIF($2, ''), email) THEN email_verified_at ELSE NULL END,
+	token_version = CASE WHEN hashed_password = COALESCE(NULLIF($3, ''), hashed_password) THEN token_version ELSE token_version + 1 END
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, token_version, timeline_materialized
 `
 
 type UpdateUserParams struct {
@@ -95,6 +202,42 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.TimelineMaterialized,
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW(), token_version = token_version + 1
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const upgradeUserPasswordHash = `-- name: UpgradeUserPasswordHash :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpgradeUserPasswordHashParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) UpgradeUserPasswordHash(ctx context.Context, arg UpgradeUserPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, upgradeUserPasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
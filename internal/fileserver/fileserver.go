@@ -0,0 +1,151 @@
+package fileserver
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CachePolicy struct {
+	Prefix       string
+	CacheControl string
+}
+
+type encoding struct {
+	name string
+	ext  string
+}
+
+// Ordered by preference when the client accepts several.
+var encodings = []encoding{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+type FileServer struct {
+	root     http.FileSystem
+	policies []CachePolicy
+	fallback string
+}
+
+func New(root string, policies ...CachePolicy) *FileServer {
+	sorted := append([]CachePolicy(nil), policies...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	return &FileServer{
+		root:     http.Dir(root),
+		policies: sorted,
+		fallback: "no-cache",
+	}
+}
+
+func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+
+	f, err := fsrv.root.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Cache-Control", fsrv.cacheControl(name))
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	content, contentInfo, enc := f, info, ""
+	for _, e := range encodings {
+		if !acceptsEncoding(r, e.name) {
+			continue
+		}
+		cf, err := fsrv.root.Open(name + e.ext)
+		if err != nil {
+			continue
+		}
+		cinfo, err := cf.Stat()
+		if err != nil || cinfo.IsDir() {
+			cf.Close()
+			continue
+		}
+		defer cf.Close()
+		content, contentInfo, enc = cf, cinfo, e.name
+		break
+	}
+
+	if enc != "" {
+		w.Header().Set("Content-Encoding", enc)
+	}
+	w.Header().Set("ETag", etag(contentInfo, enc))
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+func (fsrv *FileServer) cacheControl(name string) string {
+	for _, p := range fsrv.policies {
+		if strings.HasPrefix(name, p.Prefix) {
+			return p.CacheControl
+		}
+	}
+	return fsrv.fallback
+}
+
+func etag(info fs.FileInfo, enc string) string {
+	tag := fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	if enc != "" {
+		tag += "-" + enc
+	}
+	return `"` + tag + `"`
+}
+
+func acceptsEncoding(r *http.Request, name string) bool {
+	for _, part := range strings.Split(strings.Join(r.Header.Values("Accept-Encoding"), ","), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), name) {
+			continue
+		}
+		return qValue(params) > 0
+	}
+	return false
+}
+
+// qValue reads the weight from the parameters following a coding, e.g.
+// " q=0.5". A missing weight means 1 and a malformed one 0.
+func qValue(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(p, "=")
+		if !strings.EqualFold(strings.TrimSpace(k), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
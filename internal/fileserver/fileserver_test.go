@@ -0,0 +1,169 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestServer serves a directory where index.html has both precompressed
+// variants, app.js only a gzip one and static/logo.svg none.
+func newTestServer(t *testing.T, policies ...CachePolicy) *FileServer {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":      "<h1>plain</h1>",
+		"index.html.gz":   "gzip bytes",
+		"index.html.br":   "brotli bytes",
+		"app.js":          "console.log('plain')",
+		"app.js.gz":       "gzip js",
+		"static/logo.svg": "<svg/>",
+	}
+	for name, body := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(root, policies...)
+}
+
+func get(fsrv *FileServer, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, vs := range header {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	fsrv.ServeHTTP(w, r)
+	return w
+}
+
+func TestEncodingSelection(t *testing.T) {
+	fsrv := newTestServer(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding []string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{name: "none accepted", path: "/index.html", wantBody: "<h1>plain</h1>"},
+		{name: "br preferred", path: "/index.html", acceptEncoding: []string{"gzip, deflate, br"}, wantEncoding: "br", wantBody: "brotli bytes"},
+		{name: "gzip only", path: "/index.html", acceptEncoding: []string{"gzip"}, wantEncoding: "gzip", wantBody: "gzip bytes"},
+		{name: "br refused", path: "/index.html", acceptEncoding: []string{"br;q=0, gzip"}, wantEncoding: "gzip", wantBody: "gzip bytes"},
+		{name: "q with spaces", path: "/index.html", acceptEncoding: []string{"br ; q=0 , gzip"}, wantEncoding: "gzip", wantBody: "gzip bytes"},
+		{name: "q=0.0", path: "/index.html", acceptEncoding: []string{"gzip;q=0.0"}, wantBody: "<h1>plain</h1>"},
+		{name: "space before q", path: "/index.html", acceptEncoding: []string{"gzip; q=0"}, wantBody: "<h1>plain</h1>"},
+		{name: "upper case Q", path: "/index.html", acceptEncoding: []string{"gzip;Q=0"}, wantBody: "<h1>plain</h1>"},
+		{name: "low but positive q", path: "/index.html", acceptEncoding: []string{"gzip;q=0.001"}, wantEncoding: "gzip", wantBody: "gzip bytes"},
+		{name: "malformed q", path: "/index.html", acceptEncoding: []string{"gzip;q=lots"}, wantBody: "<h1>plain</h1>"},
+		{name: "case insensitive coding", path: "/index.html", acceptEncoding: []string{"GZIP"}, wantEncoding: "gzip", wantBody: "gzip bytes"},
+		{name: "several headers", path: "/index.html", acceptEncoding: []string{"deflate", "br"}, wantEncoding: "br", wantBody: "brotli bytes"},
+		{name: "missing variant", path: "/app.js", acceptEncoding: []string{"br, gzip"}, wantEncoding: "gzip", wantBody: "gzip js"},
+		{name: "no variants", path: "/static/logo.svg", acceptEncoding: []string{"br, gzip"}, wantBody: "<svg/>"},
+		{name: "directory index", path: "/", acceptEncoding: []string{"br"}, wantEncoding: "br", wantBody: "brotli bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(fsrv, tt.path, http.Header{"Accept-Encoding": tt.acceptEncoding})
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("got Content-Encoding %q, want %q", got, tt.wantEncoding)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+			// caches must key on the header whichever variant was chosen
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got Vary %q, want Accept-Encoding", got)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	fsrv := newTestServer(t)
+	w := get(fsrv, "/index.html", http.Header{"Accept-Encoding": {"gzip"}})
+	if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("got Content-Type %q for a compressed html file", got)
+	}
+}
+
+func TestETag(t *testing.T) {
+	fsrv := newTestServer(t)
+
+	plain := get(fsrv, "/index.html", nil).Header().Get("ETag")
+	gzip := get(fsrv, "/index.html", http.Header{"Accept-Encoding": {"gzip"}}).Header().Get("ETag")
+	if plain == "" || gzip == "" {
+		t.Fatalf("missing ETag: plain %q, gzip %q", plain, gzip)
+	}
+	if plain == gzip {
+		t.Errorf("plain and gzip variants share ETag %s", plain)
+	}
+
+	w := get(fsrv, "/index.html", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {gzip}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: got status %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("304 response has a body: %q", w.Body)
+	}
+
+	// the tag of another variant doesn't match
+	w = get(fsrv, "/index.html", http.Header{"If-None-Match": {gzip}})
+	if w.Code != http.StatusOK {
+		t.Errorf("other variant's ETag: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	fsrv := newTestServer(t,
+		CachePolicy{Prefix: "/", CacheControl: "public, max-age=60"},
+		CachePolicy{Prefix: "/static/", CacheControl: "public, max-age=31536000, immutable"},
+	)
+
+	tests := map[string]string{
+		"/index.html":      "public, max-age=60",
+		"/static/logo.svg": "public, max-age=31536000, immutable",
+	}
+	for path, want := range tests {
+		if got := get(fsrv, path, nil).Header().Get("Cache-Control"); got != want {
+			t.Errorf("%s: got Cache-Control %q, want %q", path, got, want)
+		}
+	}
+
+	if got := get(newTestServer(t), "/index.html", nil).Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("without policies: got Cache-Control %q, want no-cache", got)
+	}
+}
+
+func TestNotServed(t *testing.T) {
+	fsrv := newTestServer(t)
+
+	tests := map[string]int{
+		"/missing.html": http.StatusNotFound,
+		"/static":       http.StatusNotFound,
+		"/../go.mod":    http.StatusNotFound,
+	}
+	for path, want := range tests {
+		if got := get(fsrv, path, nil).Code; got != want {
+			t.Errorf("%s: got status %d, want %d", path, got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	fsrv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/index.html", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: got status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
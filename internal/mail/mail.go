@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func (m Message) bytes(from string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var a smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		a = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, a, s.From, []string{msg.To}, msg.bytes(s.From))
+}
+
+// FileMailer writes each message to Dir as an .eml file, for local
+// development and tests that need to read what was sent.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (f FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), uuid.New())
+	return os.WriteFile(filepath.Join(f.Dir, name), msg.bytes(f.From), 0o644)
+}
+
+// LogMailer logs messages instead of sending them. Bodies carry live
+// verification and reset links, so they are left out unless LogBody is set,
+// which is only meant for local development.
+type LogMailer struct {
+	Logger  *slog.Logger
+	LogBody bool
+}
+
+func (l LogMailer) Send(ctx context.Context, msg Message) error {
+	if !l.LogBody {
+		l.Logger.InfoContext(ctx, "email", "to", msg.To, "subject", msg.Subject, "body_bytes", len(msg.Body))
+		return nil
+	}
+	l.Logger.InfoContext(ctx, "email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
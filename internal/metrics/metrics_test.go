@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := reg.NewCounterVec("http_requests_total", "Requests served.", "method", "code")
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Add(2.5, "POST", "201")
+	requests.Inc("GET", "404")
+
+	odd := reg.NewCounterVec("odd_labels_total", "Help with a \\ backslash\nand a newline.", "path")
+	odd.Inc(`C:\dir "quoted"` + "\nline")
+
+	duration := reg.NewHistogramVec("request_duration_seconds", "Request latency.", []float64{1, 0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		duration.Observe(v, "/api/chirps")
+	}
+	duration.Observe(0.2, "/api/login")
+
+	unlabelled := reg.NewHistogramVec("job_seconds", "Job time.", []float64{1})
+	unlabelled.Observe(1)
+
+	reg.NewGaugeFunc("pool_open", "Open connections.", func() float64 { return 3 })
+	reg.NewCounterFunc("pool_waits_total", "Waits for a connection.", func() float64 { return 1e21 })
+	reg.NewGaugeFunc("not_a_number", "NaN.", math.NaN)
+
+	// never written to: the header alone
+	reg.NewCounterVec("empty_total", "Nothing yet.", "kind")
+
+	const want = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",code="200"} 2
+http_requests_total{method="GET",code="404"} 1
+http_requests_total{method="POST",code="201"} 2.5
+# HELP odd_labels_total Help with a \\ backslash\nand a newline.
+# TYPE odd_labels_total counter
+odd_labels_total{path="C:\\dir \"quoted\"\nline"} 1
+# HELP request_duration_seconds Request latency.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{route="/api/chirps",le="0.1"} 2
+request_duration_seconds_bucket{route="/api/chirps",le="0.5"} 3
+request_duration_seconds_bucket{route="/api/chirps",le="1"} 4
+request_duration_seconds_bucket{route="/api/chirps",le="+Inf"} 5
+request_duration_seconds_sum{route="/api/chirps"} 3.15
+request_duration_seconds_count{route="/api/chirps"} 5
+request_duration_seconds_bucket{route="/api/login",le="0.1"} 0
+request_duration_seconds_bucket{route="/api/login",le="0.5"} 1
+request_duration_seconds_bucket{route="/api/login",le="1"} 1
+request_duration_seconds_bucket{route="/api/login",le="+Inf"} 1
+request_duration_seconds_sum{route="/api/login"} 0.2
+request_duration_seconds_count{route="/api/login"} 1
+# HELP job_seconds Job time.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="1"} 1
+job_seconds_bucket{le="+Inf"} 1
+job_seconds_sum 1
+job_seconds_count 1
+# HELP pool_open Open connections.
+# TYPE pool_open gauge
+pool_open 3
+# HELP pool_waits_total Waits for a connection.
+# TYPE pool_waits_total counter
+pool_waits_total 1e+21
+# HELP not_a_number NaN.
+# TYPE not_a_number gauge
+not_a_number NaN
+# HELP empty_total Nothing yet.
+# TYPE empty_total counter
+`
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("output differs\n--- got\n%s\n--- want\n%s", got, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewGaugeFunc("up", "Always up.", func() float64 { return 1 })
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	if !strings.HasSuffix(w.Body.String(), "\nup 1\n") {
+		t.Errorf("unexpected body %q", w.Body)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("c_total", "C.", "a", "b")
+
+	tests := map[string]func(){
+		"negative add":     func() { c.Add(-1, "x", "y") },
+		"missing label":    func() { c.Inc("x") },
+		"extra label":      func() { c.Inc("x", "y", "z") },
+		"histogram labels": func() { reg.NewHistogramVec("h", "H.", DefaultBuckets, "a").Observe(1) },
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			f()
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/portbound/bootdev-httpserver/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider("chirpy", "secret")
+	t.Cleanup(mock.Close)
+	return mock, &Provider{
+		Name:         "mock",
+		Issuer:       mock.Issuer(),
+		ClientID:     "chirpy",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/auth/oidc/mock/callback",
+	}
+}
+
+// signIn runs the authorization code flow against the mock and returns what
+// the relying party makes of the resulting ID token.
+func signIn(t *testing.T, p *Provider) (Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, nonce := RandomString(), RandomString()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", nonce, Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: bad redirect: %v", err)
+	}
+
+	return p.Exchange(ctx, loc.Query().Get("code"), verifier, nonce)
+}
+
+func TestExchange(t *testing.T) {
+	mock, p := newTestProvider(t)
+	mock.SetUser(oidctest.User{Subject: "sub-1", Email: "a@example.com", EmailVerified: true})
+
+	id, err := signIn(t, p)
+	if err != nil {
+		t.Fatalf("signIn: %v", err)
+	}
+	want := Identity{Subject: "sub-1", Email: "a@example.com", EmailVerified: true}
+	if id != want {
+		t.Errorf("got identity %+v, want %+v", id, want)
+	}
+}
+
+func TestExchangeRejectsBadClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(jwt.MapClaims)
+		wantErr string
+	}{
+		{
+			name:    "wrong nonce",
+			tamper:  func(c jwt.MapClaims) { c["nonce"] = "not-the-nonce" },
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "missing nonce",
+			tamper:  func(c jwt.MapClaims) { delete(c, "nonce") },
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "wrong audience",
+			tamper:  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			wantErr: "audience",
+		},
+		{
+			name:    "other client authorized",
+			tamper:  func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "someone-else"}; c["azp"] = "someone-else" },
+			wantErr: "issued to another client",
+		},
+		{
+			name:    "wrong issuer",
+			tamper:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			wantErr: "issuer",
+		},
+		{
+			name:    "expired",
+			tamper:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: "expired",
+		},
+		{
+			name:    "no subject",
+			tamper:  func(c jwt.MapClaims) { delete(c, "sub") },
+			wantErr: "no subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, p := newTestProvider(t)
+			mock.SetTamper(tt.tamper)
+
+			_, err := signIn(t, p)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnknownKidRefetchesKeys(t *testing.T) {
+	mock, p := newTestProvider(t)
+
+	if _, err := signIn(t, p); err != nil {
+		t.Fatalf("first signIn: %v", err)
+	}
+	if n := mock.JWKSRequests(); n != 1 {
+		t.Fatalf("got %d jwks requests, want 1", n)
+	}
+
+	// a second sign in with the same key is served from the cache
+	if _, err := signIn(t, p); err != nil {
+		t.Fatalf("second signIn: %v", err)
+	}
+	if n := mock.JWKSRequests(); n != 1 {
+		t.Fatalf("got %d jwks requests, want 1", n)
+	}
+
+	mock.RotateKey()
+
+	// right after a fetch the unknown kid is refused without asking again
+	if _, err := signIn(t, p); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("got error %v, want unknown signing key", err)
+	}
+	if n := mock.JWKSRequests(); n != 1 {
+		t.Fatalf("got %d jwks requests, want 1", n)
+	}
+
+	// once the keys are stale the new kid triggers a refetch
+	p.mu.Lock()
+	p.keysAt = time.Now().Add(-2 * jwksRefreshInterval)
+	p.mu.Unlock()
+
+	if _, err := signIn(t, p); err != nil {
+		t.Fatalf("signIn after rotation: %v", err)
+	}
+	if n := mock.JWKSRequests(); n != 2 {
+		t.Fatalf("got %d jwks requests, want 2", n)
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+// PostgresStore shares buckets between instances. Each Take locks the bucket
+// row for the duration of a short transaction.
+type PostgresStore struct {
+	db *sql.DB
+	q  *database.Queries
+}
+
+func NewPostgresStore(db *sql.DB, q *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db, q: q}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	// timestamp columns drop the zone offset
+	now = now.UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+	qtx := s.q.WithTx(tx)
+
+	err = qtx.EnsureRateLimitBucket(ctx, database.EnsureRateLimitBucketParams{
+		Key:       key,
+		Tokens:    float64(limit.Burst),
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	row, err := qtx.GetRateLimitBucketForUpdate(ctx, key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	b := bucket{tokens: row.Tokens, updated: row.UpdatedAt}
+	res := b.take(limit, now)
+
+	err = qtx.UpdateRateLimitBucket(ctx, database.UpdateRateLimitBucketParams{
+		Key:       key,
+		Tokens:    b.tokens,
+		UpdatedAt: b.updated,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+func (s *PostgresStore) Cleanup(ctx context.Context, before time.Time) error {
+	return s.q.DeleteStaleRateLimitBuckets(ctx, before.UTC())
+}
+
+func (s *PostgresStore) Reset(ctx context.Context) error {
+	return s.q.ResetRateLimitBuckets(ctx)
+}
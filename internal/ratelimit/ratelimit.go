@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit describes a token bucket: Burst requests may be made at once and the
+// bucket refills at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit reads limits written as "<burst>/<period>", e.g. "10/1m" allows
+// ten requests at once, refilled evenly over a minute.
+func ParseLimit(s string) (Limit, error) {
+	n, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected <count>/<duration>", s)
+	}
+	burst, err := strconv.Atoi(n)
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: count must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad duration", s)
+	}
+	return Limit{Rate: float64(burst) / d.Seconds(), Burst: burst}, nil
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	// time until the bucket is full again
+	Reset time.Duration
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// Cleanup drops buckets untouched since before; they would be full by now
+	// anyway as long as before is older than the slowest refill period.
+	Cleanup(ctx context.Context, before time.Time) error
+	// Reset drops every bucket.
+	Reset(ctx context.Context) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b for the time elapsed since its last update and consumes one
+// token if available. Both stores share it so they behave identically.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	// instances sharing a store may disagree slightly on the time; never let
+	// the bucket move backwards
+	if now.After(b.updated) {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+		b.updated = now
+	}
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/portbound/bootdev-httpserver/internal/database"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "10/1m", want: Limit{Rate: 10.0 / 60, Burst: 10}},
+		{in: "5/10m", want: Limit{Rate: 5.0 / 600, Burst: 5}},
+		{in: "1/500ms", want: Limit{Rate: 2, Burst: 1}},
+		{in: "", wantErr: true},
+		{in: "10", wantErr: true},
+		{in: "10/", wantErr: true},
+		{in: "/1m", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "0/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "10/1", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "10/-1m", wantErr: true},
+		{in: "10/1m/1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testStore runs the shared bucket behaviour against a store. Every call
+// uses its own key so stores that persist between runs start out empty.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 3} // 3 at once, one more per second
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type take struct {
+		after         time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst then refuse",
+			takes: []take{
+				{0, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{0, false, 0, time.Second},
+			},
+		},
+		{
+			name: "refill",
+			takes: []take{
+				{0, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+				{time.Second, true, 0, 0},
+				{3 * time.Second, true, 1, 0},
+			},
+		},
+		{
+			name: "refill caps at burst",
+			takes: []take{
+				{0, true, 2, 0},
+				{time.Hour, true, 2, 0},
+			},
+		},
+		{
+			name: "clock going backwards",
+			takes: []take{
+				{time.Second, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{0, false, 0, time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "test:" + uuid.NewString()
+			for i, tk := range tt.takes {
+				res, err := store.Take(ctx, key, limit, start.Add(tk.after))
+				if err != nil {
+					t.Fatalf("take %d: %v", i, err)
+				}
+				if res.Allowed != tk.wantAllowed || res.Remaining != tk.wantRemaining || res.RetryAfter != tk.wantRetry {
+					t.Errorf("take %d: got allowed=%v remaining=%d retry=%s, want allowed=%v remaining=%d retry=%s",
+						i, res.Allowed, res.Remaining, res.RetryAfter, tk.wantAllowed, tk.wantRemaining, tk.wantRetry)
+				}
+				if res.Limit != limit.Burst {
+					t.Errorf("take %d: got limit %d, want %d", i, res.Limit, limit.Burst)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+// TestPostgresStore needs a migrated database in TEST_DB_URL.
+func TestPostgresStore(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testStore(t, NewPostgresStore(db, database.New(db)))
+}
+
+func TestMemoryStoreCleanup(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	store.Take(ctx, "old", limit, now)
+	store.Take(ctx, "new", limit, now.Add(time.Minute))
+	if err := store.Cleanup(ctx, now.Add(time.Second)); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+
+	// a dropped bucket starts out full again
+	if res, _ := store.Take(ctx, "old", limit, now.Add(time.Minute)); !res.Allowed {
+		t.Error("old bucket was not dropped")
+	}
+	if res, _ := store.Take(ctx, "new", limit, now.Add(time.Minute)); res.Allowed {
+		t.Error("new bucket was dropped")
+	}
+}
@@ -1,31 +1,81 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/portbound/bootdev-httpserver/api"
 	"github.com/portbound/bootdev-httpserver/api/handlers"
+	"github.com/portbound/bootdev-httpserver/internal/fileserver"
 )
 
 func main() {
+	if err := run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
 	cfg, err := api.NewConfig()
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
+	defer cfg.Close()
 
 	mux := http.NewServeMux()
 
+	// App
+	pages := fileserver.New("pages")
+	assets := fileserver.New("assets", fileserver.CachePolicy{Prefix: "/", CacheControl: "public, max-age=86400"})
+	mux.Handle("/app/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app", pages)))
+	mux.Handle("/app/assets/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app/assets", assets)))
+
 	// Admin
+	mux.HandleFunc("GET /admin/metrics", cfg.HandlerMetrics)
 	mux.HandleFunc("POST /admin/reset", cfg.HandlerReset)
-	mux.HandleFunc("GET /api/healthz", cfg.HandlerReadiness)
+	mux.HandleFunc("POST /admin/users/{user_id}/unlock", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.UnlockUser(w, r, cfg, userID)
+	})
+	mux.HandleFunc("POST /admin/users/{user_id}/revoke-tokens", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.RevokeUserTokens(w, r, cfg, userID)
+	})
+	// kept for clients of the old endpoint; it now reports readiness too
+	mux.HandleFunc("GET /api/healthz", cfg.HandlerReadyz)
+	mux.HandleFunc("GET /api/livez", cfg.HandlerLiveness)
+	mux.HandleFunc("GET /api/readyz", cfg.HandlerReadyz)
+	mux.HandleFunc("GET /metrics", cfg.HandlerPrometheus)
 
 	// Auth
-	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("POST /api/login", cfg.MiddlewareRateLimit("login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.Login(w, r, cfg)
+	})))
+	mux.Handle("POST /api/login/mfa", cfg.MiddlewareRateLimit("login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.LoginMFA(w, r, cfg)
+	})))
+	mux.HandleFunc("POST /api/mfa/totp/enroll", func(w http.ResponseWriter, r *http.Request) {
+		handlers.EnrollTOTP(w, r, cfg)
+	})
+	mux.HandleFunc("POST /api/mfa/totp/confirm", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ConfirmTOTP(w, r, cfg)
 	})
 	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
 		handlers.RefreshAccessToken(w, r, cfg)
@@ -33,22 +83,100 @@ func main() {
 	mux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) {
 		handlers.RevokeRefreshToken(w, r, cfg)
 	})
+	mux.HandleFunc("POST /api/logout", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Logout(w, r, cfg)
+	})
+	mux.Handle("POST /api/password/forgot", cfg.MiddlewareRateLimit("email", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ForgotPassword(w, r, cfg)
+	})))
+	mux.Handle("POST /api/password/reset", cfg.MiddlewareRateLimit("email", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ResetPassword(w, r, cfg)
+	})))
+	mux.Handle("GET /api/oauth/{provider}/login", cfg.MiddlewareRateLimit("login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.OIDCLogin(w, r, cfg, r.PathValue("provider"))
+	})))
+	mux.Handle("GET /api/oauth/{provider}/callback", cfg.MiddlewareRateLimit("login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.OIDCCallback(w, r, cfg, r.PathValue("provider"))
+	})))
+	mux.HandleFunc("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetJWKS(w, r, cfg)
+	})
 
 	// Users
-	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("POST /api/users", cfg.MiddlewareRateLimit("signup", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.CreateUser(w, r, cfg)
-	})
+	})))
 	mux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) {
 		handlers.UpdateUser(w, r, cfg)
 	})
+	mux.HandleFunc("GET /api/users/verify", func(w http.ResponseWriter, r *http.Request) {
+		handlers.VerifyEmail(w, r, cfg)
+	})
+	mux.Handle("POST /api/users/verify/resend", cfg.MiddlewareRateLimit("email", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ResendVerificationEmail(w, r, cfg)
+	})))
+	mux.HandleFunc("POST /api/users/{user_id}/follow", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.FollowUser(w, r, cfg, userID)
+	})
+	mux.HandleFunc("DELETE /api/users/{user_id}/follow", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.UnfollowUser(w, r, cfg, userID)
+	})
+	mux.HandleFunc("GET /api/users/{user_id}/followers", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.ListFollowers(w, r, cfg, userID)
+	})
+	mux.HandleFunc("GET /api/users/{user_id}/following", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.ListFollowing(w, r, cfg, userID)
+	})
+	mux.HandleFunc("GET /api/timeline", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetTimeline(w, r, cfg)
+	})
+
+	// Sessions
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ListSessions(w, r, cfg)
+	})
+	mux.HandleFunc("DELETE /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RevokeAllSessions(w, r, cfg)
+	})
+	mux.HandleFunc("DELETE /api/sessions/{session_id}", func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := uuid.Parse(r.PathValue("session_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.RevokeSession(w, r, cfg, sessionID)
+	})
 
 	// Chirps
-	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("POST /api/chirps", cfg.MiddlewareRateLimit("chirp", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.CreateChirp(w, r, cfg)
-	})
+	})))
 	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
 		handlers.GetAllChirps(w, r, cfg)
 	})
+	mux.HandleFunc("GET /api/chirps/search", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SearchChirps(w, r, cfg)
+	})
 	mux.HandleFunc("GET /api/chirps/{chirp_id}", func(w http.ResponseWriter, r *http.Request) {
 		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
 		if err != nil {
@@ -57,6 +185,70 @@ func main() {
 		}
 		handlers.GetChirp(w, r, cfg, chirpID)
 	})
+	mux.HandleFunc("PUT /api/chirps/{chirp_id}", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.EditChirp(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("PATCH /api/chirps/{chirp_id}", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.EditChirp(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirp_id}/thread", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.GetChirpThread(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirp_id}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.GetChirpRevisions(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirp_id}/like", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.LikeChirp(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{chirp_id}/like", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.UnlikeChirp(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirp_id}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.RechirpChirp(w, r, cfg, chirpID)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{chirp_id}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+		if err != nil {
+			api.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		handlers.UndoRechirp(w, r, cfg, chirpID)
+	})
 	mux.HandleFunc("DELETE /api/chirps/{chirp_id}", func(w http.ResponseWriter, r *http.Request) {
 		chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
 		if err != nil {
@@ -71,6 +263,73 @@ func main() {
 		handlers.UpgradeToChirpyRed(w, r, cfg)
 	})
 
-	server := &http.Server{Addr: ":8080", Handler: mux}
-	server.ListenAndServe()
+	handler := cfg.MiddlewareRequestID(cfg.MiddlewareLogging(cfg.MiddlewareMetrics(cfg.MiddlewareMaxBytes(mux))))
+
+	server := &http.Server{
+		Addr:           cfg.Server.Addr,
+		Handler:        handler,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
+		IdleTimeout:    cfg.Server.IdleTimeout,
+		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := cfg.RateLimit.Cleanup(ctx); err != nil {
+					cfg.Logger.Error("rate limit cleanup failed", "error", err)
+				}
+				if err := cfg.CleanupRefreshTokens(ctx); err != nil {
+					cfg.Logger.Error("refresh token cleanup failed", "error", err)
+				}
+				if err := cfg.CleanupFailedLogins(ctx); err != nil {
+					cfg.Logger.Error("failed login cleanup failed", "error", err)
+				}
+				if err := cfg.Revocations.Cleanup(ctx); err != nil {
+					cfg.Logger.Error("token revocation cleanup failed", "error", err)
+				}
+				if err := cfg.DbQueries.DeleteExpiredOAuthStates(ctx, time.Now().UTC()); err != nil {
+					cfg.Logger.Error("oauth state cleanup failed", "error", err)
+				}
+			}
+		}
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		cfg.Logger.Info("server starting", "addr", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	cfg.Logger.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout.String())
+	// fail readiness first so the load balancer stops routing to us before
+	// the listener closes
+	cfg.ShuttingDown.Store(true)
+	time.Sleep(cfg.Server.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+	return nil
 }
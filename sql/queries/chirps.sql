@@ -1,24 +1,152 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, root_id)
 VALUES(
 		gen_random_uuid(),
-		NOW(),
-		NOW(),
-		$1,
-		$2
+		sqlc.arg('now')::timestamp,
+		sqlc.arg('now')::timestamp,
+		sqlc.arg('body'),
+		sqlc.arg('user_id'),
+		sqlc.arg('parent_id'),
+		sqlc.arg('root_id')
 )
 RETURNING *;
 
--- name: GetAllChirps :many
-SELECT * FROM chirps ORDER BY created_at;
+-- name: IncrementReplyCount :exec
+UPDATE chirps SET reply_count = reply_count + 1 WHERE id = $1;
 
--- name: GetAllChirpsFromUser :many
-SELECT * FROM chirps 
-WHERE user_id = $1
-ORDER BY created_at;
+-- name: DecrementReplyCount :exec
+UPDATE chirps SET reply_count = reply_count - 1 WHERE id = $1 AND reply_count > 0;
+
+-- name: GetChirpThread :many
+WITH RECURSIVE thread AS (
+	SELECT c.*, 0 AS depth
+	FROM chirps c
+	WHERE c.id = sqlc.arg('id')
+	UNION ALL
+	SELECT c.*, t.depth + 1
+	FROM chirps c
+	JOIN thread t ON c.parent_id = t.id
+	WHERE t.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, depth
+FROM thread
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT sqlc.arg('max_chirps');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+	SELECT c.*, 1 AS distance
+	FROM chirps c
+	WHERE c.id = (SELECT parent_id FROM chirps WHERE chirps.id = sqlc.arg('id'))
+	UNION ALL
+	SELECT c.*, a.distance + 1
+	FROM chirps c
+	JOIN ancestors a ON c.id = a.parent_id
+	WHERE a.distance < sqlc.arg('max_chirps')::int
+)
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, distance
+FROM ancestors
+ORDER BY distance ASC;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: ListAuthorFeedAsc :many
+SELECT c.*, feed.activity_at, feed.is_rechirp
+FROM (
+	SELECT id AS chirp_id, created_at AS activity_at, false AS is_rechirp
+	FROM chirps WHERE user_id = sqlc.arg('author_id')
+	UNION ALL
+	SELECT chirp_id, created_at, true
+	FROM rechirps WHERE user_id = sqlc.arg('author_id')
+) feed
+JOIN chirps c ON c.id = feed.chirp_id
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+OR (feed.activity_at, feed.chirp_id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY feed.activity_at ASC, feed.chirp_id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: ListAuthorFeedDesc :many
+SELECT c.*, feed.activity_at, feed.is_rechirp
+FROM (
+	SELECT id AS chirp_id, created_at AS activity_at, false AS is_rechirp
+	FROM chirps WHERE user_id = sqlc.arg('author_id')
+	UNION ALL
+	SELECT chirp_id, created_at, true
+	FROM rechirps WHERE user_id = sqlc.arg('author_id')
+) feed
+JOIN chirps c ON c.id = feed.chirp_id
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+OR (feed.activity_at, feed.chirp_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY feed.activity_at DESC, feed.chirp_id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, reply_count, like_count, rechirp_count, rank
+FROM (
+	SELECT c.*,
+		(ts_rank(to_tsvector('english', coalesce(c.body, '')), to_tsquery('english', sqlc.arg('query')))
+		/ (1 + EXTRACT(EPOCH FROM sqlc.arg('now')::timestamp - c.created_at) / sqlc.arg('half_life_seconds')::float8))::float8
+		AS rank
+	FROM chirps c
+	WHERE to_tsvector('english', coalesce(c.body, '')) @@ to_tsquery('english', sqlc.arg('query'))
+	AND (sqlc.narg('author_id')::uuid IS NULL OR c.user_id = sqlc.narg('author_id')::uuid)
+	AND c.created_at <= sqlc.arg('now')::timestamp
+) ranked
+WHERE sqlc.narg('cursor_rank')::float8 IS NULL
+OR (rank, id) < (sqlc.narg('cursor_rank')::float8, sqlc.narg('cursor_id')::uuid)
+ORDER BY rank DESC, id DESC
+LIMIT sqlc.arg('page_size');
 
 -- name: GetChirp :one
 SELECT * FROM chirps WHERE id = $1;
 
--- name: DeleteChirp :exec
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps WHERE id = $1 FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = sqlc.arg('body'), updated_at = sqlc.arg('now')::timestamp, edited_at = sqlc.arg('now')::timestamp
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, written_at, replaced_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4
+);
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at ASC, id ASC;
+
+-- name: DeleteChirp :execrows
 DELETE FROM chirps WHERE id = $1;
+
+-- name: ResetChirps :exec
+TRUNCATE chirps CASCADE;
+
+-- name: ResetChirpRevisions :exec
+TRUNCATE chirp_revisions CASCADE;
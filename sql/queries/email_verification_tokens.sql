@@ -0,0 +1,19 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (id, user_id, created_at, expires_at, used_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	NULL
+)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = sqlc.arg('now')::timestamp
+WHERE id = sqlc.arg('id') AND user_id = sqlc.arg('user_id') AND used_at IS NULL AND expires_at > sqlc.arg('now')::timestamp
+RETURNING user_id;
+
+-- name: ResetEmailVerificationTokens :exec
+TRUNCATE email_verification_tokens CASCADE;
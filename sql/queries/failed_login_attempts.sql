@@ -0,0 +1,41 @@
+-- name: RecordFailedLogin :exec
+INSERT INTO failed_login_attempts (id, email, user_id, ip, attempted_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4
+);
+
+-- name: GetFailedLoginsForEmail :one
+SELECT
+	COUNT(*) AS failures,
+	COALESCE(MAX(attempted_at), 'epoch'::timestamp)::timestamp AS last_attempt
+FROM failed_login_attempts
+WHERE email = $1 AND attempted_at > $2;
+
+-- name: GetFailedLoginsForIP :one
+SELECT
+	COUNT(*) AS failures,
+	COALESCE(MAX(attempted_at), 'epoch'::timestamp)::timestamp AS last_attempt
+FROM failed_login_attempts
+WHERE ip = $1 AND attempted_at > $2;
+
+-- name: ClearFailedLogins :exec
+DELETE FROM failed_login_attempts WHERE email = $1;
+
+-- name: ClearFailedLoginsForUser :exec
+DELETE FROM failed_login_attempts
+WHERE email = sqlc.arg('email')
+	OR user_id = sqlc.arg('user_id')::uuid
+	OR ip IN (
+		SELECT f.ip FROM failed_login_attempts f
+		WHERE f.email = sqlc.arg('email') OR f.user_id = sqlc.arg('user_id')::uuid
+	);
+
+-- name: DeleteOldFailedLogins :execrows
+DELETE FROM failed_login_attempts WHERE attempted_at < $1;
+
+-- name: ResetFailedLoginAttempts :exec
+TRUNCATE failed_login_attempts CASCADE;
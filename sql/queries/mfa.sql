@@ -0,0 +1,54 @@
+-- name: StartTOTPEnrollment :one
+INSERT INTO user_totp (user_id, secret, confirmed_at, last_used_step, created_at)
+VALUES(
+	$1,
+	$2,
+	NULL,
+	0,
+	NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: ConfirmTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL AND last_used_step < $2;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (id, user_id, code_hash, used_at, created_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	NULL,
+	NOW()
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1;
+
+-- name: ListUnusedRecoveryCodes :many
+SELECT * FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: ResetUserTOTP :exec
+TRUNCATE user_totp CASCADE;
+
+-- name: ResetRecoveryCodes :exec
+TRUNCATE mfa_recovery_codes CASCADE;
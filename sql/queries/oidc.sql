@@ -0,0 +1,38 @@
+-- name: CreateOAuthState :exec
+INSERT INTO oauth_states (state, provider, code_verifier, nonce, created_at, expires_at)
+VALUES(
+	sqlc.arg('state'),
+	sqlc.arg('provider'),
+	sqlc.arg('code_verifier'),
+	sqlc.arg('nonce'),
+	sqlc.arg('now')::timestamp,
+	sqlc.arg('expires_at')::timestamp
+);
+
+-- name: ConsumeOAuthState :one
+DELETE FROM oauth_states
+WHERE state = sqlc.arg('state') AND provider = sqlc.arg('provider') AND expires_at > sqlc.arg('now')::timestamp
+RETURNING *;
+
+-- name: DeleteExpiredOAuthStates :exec
+DELETE FROM oauth_states WHERE expires_at < $1;
+
+-- name: GetLinkedIdentity :one
+SELECT * FROM linked_identities WHERE provider = $1 AND subject = $2;
+
+-- name: CreateLinkedIdentity :exec
+INSERT INTO linked_identities (id, user_id, provider, subject, email, created_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW()
+);
+
+-- name: ResetOAuthStates :exec
+TRUNCATE oauth_states CASCADE;
+
+-- name: ResetLinkedIdentities :exec
+TRUNCATE linked_identities CASCADE;
@@ -0,0 +1,24 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at, used_at)
+VALUES(
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NULL
+);
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = sqlc.arg('now')::timestamp
+WHERE token_hash = sqlc.arg('token_hash') AND used_at IS NULL AND expires_at > sqlc.arg('now')::timestamp
+RETURNING user_id;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = sqlc.arg('now')::timestamp
+WHERE user_id = sqlc.arg('user_id') AND used_at IS NULL;
+
+-- name: ResetPasswordResetTokens :exec
+TRUNCATE password_reset_tokens CASCADE;
@@ -0,0 +1,18 @@
+-- name: EnsureRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+VALUES($1, $2, $3)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: GetRateLimitBucketForUpdate :one
+SELECT * FROM rate_limit_buckets WHERE key = $1 FOR UPDATE;
+
+-- name: UpdateRateLimitBucket :exec
+UPDATE rate_limit_buckets
+SET tokens = $2, updated_at = $3
+WHERE key = $1;
+
+-- name: DeleteStaleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets WHERE updated_at < $1;
+
+-- name: ResetRateLimitBuckets :exec
+TRUNCATE rate_limit_buckets CASCADE;
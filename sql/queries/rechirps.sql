@@ -0,0 +1,11 @@
+-- name: Rechirp :execrows
+INSERT INTO rechirps (user_id, chirp_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: UndoRechirp :execrows
+DELETE FROM rechirps
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: ResetRechirps :exec
+TRUNCATE rechirps CASCADE;
@@ -1,19 +1,60 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_id, user_agent, ip, session_created_at)
 VALUES(
-	$1,
-	NOW(),
-	NOW(),
-	$2,
-	NOW() + interval '60 days',
-	NULL
+	gen_random_uuid(),
+	sqlc.arg('token_hash'),
+	sqlc.arg('now')::timestamp,
+	sqlc.arg('now')::timestamp,
+	sqlc.arg('user_id'),
+	sqlc.arg('expires_at')::timestamp,
+	NULL,
+	sqlc.arg('family_id'),
+	sqlc.arg('parent_id'),
+	sqlc.arg('user_agent'),
+	sqlc.arg('ip'),
+	sqlc.arg('session_created_at')
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
-SELECT * FROM refresh_tokens WHERE token = $1 LIMIT 1;
+SELECT * FROM refresh_tokens WHERE token_hash = $1 LIMIT 1;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1 LIMIT 1 FOR UPDATE;
 
 -- name: RevokeRefreshToken :exec
-UPDATE refresh_tokens 
-SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+UPDATE refresh_tokens
+SET revoked_at = sqlc.arg('now')::timestamp, updated_at = sqlc.arg('now')::timestamp
+WHERE token_hash = sqlc.arg('token_hash');
+
+-- name: ConsumeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = sqlc.arg('now')::timestamp, updated_at = sqlc.arg('now')::timestamp
+WHERE id = sqlc.arg('id');
+
+-- name: RefreshTokenWasRotated :one
+SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE parent_id = $1);
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = sqlc.arg('now')::timestamp, updated_at = sqlc.arg('now')::timestamp
+WHERE family_id = sqlc.arg('family_id') AND user_id = sqlc.arg('user_id') AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = sqlc.arg('now')::timestamp, updated_at = sqlc.arg('now')::timestamp
+WHERE user_id = sqlc.arg('user_id') AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT family_id, session_created_at, created_at AS last_used_at, expires_at, user_agent, ip
+FROM refresh_tokens
+WHERE user_id = sqlc.arg('user_id') AND revoked_at IS NULL AND expires_at > sqlc.arg('now')::timestamp
+ORDER BY created_at DESC;
+
+-- name: DeleteStaleRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < sqlc.arg('expired_before')::timestamp
+	OR revoked_at < sqlc.arg('revoked_before')::timestamp;
+
+-- name: ResetRefreshTokens :exec
+TRUNCATE refresh_tokens CASCADE;
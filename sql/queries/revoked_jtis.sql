@@ -0,0 +1,28 @@
+-- name: RevokeJTI :exec
+INSERT INTO revoked_jtis (jti, user_id, expires_at, revoked_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	NOW()
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: ConsumeJTI :execrows
+INSERT INTO revoked_jtis (jti, user_id, expires_at, revoked_at)
+VALUES(
+	$1,
+	$2,
+	$3,
+	NOW()
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsJTIRevoked :one
+SELECT EXISTS(SELECT 1 FROM revoked_jtis WHERE jti = $1);
+
+-- name: DeleteExpiredRevokedJTIs :exec
+DELETE FROM revoked_jtis WHERE expires_at < $1;
+
+-- name: ResetRevokedJTIs :exec
+TRUNCATE revoked_jtis CASCADE;
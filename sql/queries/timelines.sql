@@ -0,0 +1,74 @@
+-- name: ListTimeline :many
+SELECT c.* FROM chirps c
+JOIN follows f ON f.followee_id = c.user_id
+WHERE f.follower_id = sqlc.arg('user_id')
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (c.created_at, c.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: ListMaterializedTimeline :many
+SELECT c.* FROM timeline_entries t
+JOIN chirps c ON c.id = t.chirp_id
+WHERE t.user_id = sqlc.arg('user_id')
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (t.created_at, t.chirp_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY t.created_at DESC, t.chirp_id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: MaterializeTimeline :execrows
+UPDATE users
+SET timeline_materialized = true
+WHERE id = $1 AND NOT timeline_materialized;
+
+-- name: BackfillTimeline :exec
+INSERT INTO timeline_entries (user_id, chirp_id, created_at)
+SELECT f.follower_id, c.id, c.created_at
+FROM follows f
+JOIN chirps c ON c.user_id = f.followee_id
+WHERE f.follower_id = sqlc.arg('user_id')
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT sqlc.arg('max_entries')
+ON CONFLICT DO NOTHING;
+
+-- name: BackfillTimelineFollowee :exec
+INSERT INTO timeline_entries (user_id, chirp_id, created_at)
+SELECT sqlc.arg('user_id')::uuid, c.id, c.created_at
+FROM chirps c
+WHERE c.user_id = sqlc.arg('followee_id')
+AND (c.created_at, c.id) >= (
+	SELECT t.created_at, t.chirp_id FROM timeline_entries t
+	WHERE t.user_id = sqlc.arg('user_id')::uuid
+	ORDER BY t.created_at ASC, t.chirp_id ASC
+	LIMIT 1
+)
+ON CONFLICT DO NOTHING;
+
+-- name: FanOutChirp :exec
+INSERT INTO timeline_entries (user_id, chirp_id, created_at)
+SELECT f.follower_id, c.id, c.created_at
+FROM chirps c
+JOIN follows f ON f.followee_id = c.user_id
+JOIN users u ON u.id = f.follower_id
+WHERE c.id = $1 AND u.timeline_materialized
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveFromTimeline :exec
+DELETE FROM timeline_entries t
+USING chirps c
+WHERE t.chirp_id = c.id AND t.user_id = sqlc.arg('user_id') AND c.user_id = sqlc.arg('followee_id');
+
+-- name: DematerializeTimeline :execrows
+UPDATE users
+SET timeline_materialized = false
+WHERE id = $1 AND timeline_materialized;
+
+-- name: ClearTimeline :exec
+DELETE FROM timeline_entries WHERE user_id = $1;
+
+-- name: ResetTimelineEntries :exec
+TRUNCATE timeline_entries CASCADE;
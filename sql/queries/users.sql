@@ -15,11 +15,58 @@ SELECT * FROM users WHERE email = $1;
 
 -- name: UpdateUser :one
 UPDATE users 
-SET updated_at = NOW(), email = $2, hashed_password = $3 
-WHERE id = $1
+SET updated_at = NOW(),
+	email = COALESCE(NULLIF(sqlc.arg('email'), ''), email),
+	hashed_password = COALESCE(NULLIF(sqlc.arg('hashed_password'), ''), hashed_password),
+	email_verified_at = CASE WHEN email = COALESCE(NULLIF(sqlc.arg('email'), ''), email) THEN email_verified_at ELSE NULL END,
+	token_version = CASE WHEN hashed_password = COALESCE(NULLIF(sqlc.arg('hashed_password'), ''), hashed_password) THEN token_version ELSE token_version + 1 END
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 -- name: SetIsChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1;
+
+-- name: ResetUsers :exec
+TRUNCATE users CASCADE;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SetEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW(), token_version = token_version + 1
+WHERE id = $1;
+
+-- name: UpgradeUserPasswordHash :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: GetUserTokenVersion :one
+SELECT token_version FROM users WHERE id = $1;
+
+-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version;
+
+-- name: CreateVerifiedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at)
+VALUES(
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	'',
+	false,
+	NOW()
+)
+RETURNING *;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN parent_token TEXT;
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_parent_token_idx ON refresh_tokens (parent_token);
+
+-- +goose Down
+DROP INDEX refresh_tokens_parent_token_idx;
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN parent_token;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE failed_login_attempts (
+    id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    attempted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX failed_login_attempts_email_idx ON failed_login_attempts (email, attempted_at);
+CREATE INDEX failed_login_attempts_ip_idx ON failed_login_attempts (ip, attempted_at);
+
+-- +goose Down
+DROP TABLE failed_login_attempts;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN session_created_at TIMESTAMP;
+UPDATE refresh_tokens t
+SET session_created_at = (
+    SELECT COALESCE(MIN(f.created_at), NOW()) FROM refresh_tokens f WHERE f.family_id = t.family_id
+);
+ALTER TABLE refresh_tokens ALTER COLUMN session_created_at SET NOT NULL;
+CREATE INDEX refresh_tokens_user_id_active_idx ON refresh_tokens (user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_active_idx;
+ALTER TABLE refresh_tokens DROP COLUMN session_created_at;
+ALTER TABLE refresh_tokens DROP COLUMN ip;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN id UUID;
+UPDATE refresh_tokens SET id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN id SET NOT NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN token_hash TEXT;
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN parent_id UUID;
+UPDATE refresh_tokens t SET parent_id = p.id FROM refresh_tokens p WHERE t.parent_token = p.token;
+DROP INDEX refresh_tokens_parent_token_idx;
+ALTER TABLE refresh_tokens DROP COLUMN parent_token;
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ADD PRIMARY KEY (id);
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash);
+CREATE INDEX refresh_tokens_parent_id_idx ON refresh_tokens (parent_id);
+
+-- +goose Down
+-- the raw tokens are gone, so every session has to log in again after this
+ALTER TABLE refresh_tokens ADD COLUMN token TEXT;
+UPDATE refresh_tokens SET token = token_hash;
+ALTER TABLE refresh_tokens ADD COLUMN parent_token TEXT;
+UPDATE refresh_tokens t SET parent_token = p.token FROM refresh_tokens p WHERE t.parent_id = p.id;
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE revoked_at IS NULL;
+
+DROP INDEX refresh_tokens_parent_id_idx;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN parent_id;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+ALTER TABLE refresh_tokens DROP COLUMN id;
+ALTER TABLE refresh_tokens ALTER COLUMN token SET NOT NULL;
+ALTER TABLE refresh_tokens ADD PRIMARY KEY (token);
+CREATE INDEX refresh_tokens_parent_token_idx ON refresh_tokens (parent_token);
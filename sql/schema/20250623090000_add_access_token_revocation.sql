@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE revoked_jtis (
+    jti UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_jtis_expires_at_idx ON revoked_jtis (expires_at);
+
+-- +goose Down
+DROP TABLE revoked_jtis;
+ALTER TABLE users DROP COLUMN token_version;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE chirps
+    ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    ADD COLUMN root_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX chirps_parent_id_created_at_id_idx ON chirps (parent_id, created_at, id);
+CREATE INDEX chirps_root_id_idx ON chirps (root_id);
+
+-- +goose Down
+DROP INDEX chirps_root_id_idx;
+DROP INDEX chirps_parent_id_created_at_id_idx;
+ALTER TABLE chirps
+    DROP COLUMN reply_count,
+    DROP COLUMN root_id,
+    DROP COLUMN parent_id;
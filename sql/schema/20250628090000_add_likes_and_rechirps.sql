@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE chirps
+    ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN rechirp_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, chirp_id)
+);
+
+CREATE INDEX likes_chirp_id_idx ON likes (chirp_id);
+
+CREATE TABLE rechirps (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, chirp_id)
+);
+
+CREATE INDEX rechirps_chirp_id_idx ON rechirps (chirp_id);
+CREATE INDEX rechirps_user_id_created_at_idx ON rechirps (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE rechirps;
+DROP TABLE likes;
+ALTER TABLE chirps
+    DROP COLUMN rechirp_count,
+    DROP COLUMN like_count;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- An expression index rather than a stored tsvector column, so reading a
+-- chirp never drags its vector along. Queries must use the same expression.
+DROP INDEX chirps_search_vector_idx;
+ALTER TABLE chirps DROP COLUMN search_vector;
+
+CREATE INDEX chirps_search_idx ON chirps USING GIN (to_tsvector('english', coalesce(body, '')));
+
+-- +goose Down
+DROP INDEX chirps_search_idx;
+
+ALTER TABLE chirps ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(body, ''))) STORED;
+
+CREATE INDEX chirps_search_vector_idx ON chirps USING GIN (search_vector);
@@ -0,0 +1,45 @@
+-- +goose Up
+-- The counters follow the rows through triggers, so they stay right when a
+-- deleted user's likes and rechirps go with them.
+-- +goose StatementBegin
+CREATE FUNCTION count_chirp_likes() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET like_count = like_count + 1 WHERE id = NEW.chirp_id;
+    ELSE
+        UPDATE chirps SET like_count = like_count - 1 WHERE id = OLD.chirp_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION count_chirp_rechirps() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET rechirp_count = rechirp_count + 1 WHERE id = NEW.chirp_id;
+    ELSE
+        UPDATE chirps SET rechirp_count = rechirp_count - 1 WHERE id = OLD.chirp_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER likes_count AFTER INSERT OR DELETE ON likes
+    FOR EACH ROW EXECUTE FUNCTION count_chirp_likes();
+
+CREATE TRIGGER rechirps_count AFTER INSERT OR DELETE ON rechirps
+    FOR EACH ROW EXECUTE FUNCTION count_chirp_rechirps();
+
+-- counts kept by the application may have drifted when users were deleted
+UPDATE chirps SET
+    like_count = (SELECT count(*) FROM likes WHERE likes.chirp_id = chirps.id),
+    rechirp_count = (SELECT count(*) FROM rechirps WHERE rechirps.chirp_id = chirps.id);
+
+-- +goose Down
+DROP TRIGGER rechirps_count ON rechirps;
+DROP TRIGGER likes_count ON likes;
+DROP FUNCTION count_chirp_rechirps;
+DROP FUNCTION count_chirp_likes;